@@ -0,0 +1,140 @@
+package makeversion
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errBatchClosed = errors.New("batch process closed")
+
+// batchArgs are the git arguments used to start the batch process.
+var batchArgs = []string{"cat-file", "--batch-check"}
+
+// BatchGitter is a Gitter that answers tree hash, tag type and commit
+// lookups in one repository through a long-lived "git cat-file --batch-check"
+// process, instead of starting git for each of them. Other calls, and calls
+// for other repositories, run git like the embedded GitRunner does.
+// That includes the describe, branch, rev-list and write-tree commands
+// GetVersion runs, so it mostly helps when looking up many tags.
+//
+// It is safe for concurrent use. Call Close when done with it.
+type BatchGitter struct {
+	*GitRunner
+	*batchProcess
+}
+
+// batchProcess is the batch process, shared by the BatchGitters returned by RecordErrors.
+type batchProcess struct {
+	repo   string
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	cancel context.CancelFunc
+	err    error // why the batch process can't be used, if it can't
+}
+
+// NewBatchGitter starts "git cat-file --batch-check" in the repository,
+// running git with the settings in gr.
+func NewBatchGitter(gr *GitRunner, repo string) (bg *BatchGitter, err error) {
+	b := &BatchGitter{GitRunner: gr, batchProcess: &batchProcess{repo: repo}}
+	var ctx context.Context
+	ctx, b.cancel = context.WithCancel(gr.context())
+	b.cmd = gr.command(ctx, repo, batchArgs...)
+	var stdout io.ReadCloser
+	if b.stdin, err = b.cmd.StdinPipe(); err == nil {
+		if stdout, err = b.cmd.StdoutPipe(); err == nil {
+			if err = b.cmd.Start(); err == nil {
+				b.stdout = bufio.NewReader(stdout)
+				return b, nil
+			}
+		}
+	}
+	b.cancel()
+	return
+}
+
+// RecordErrors returns a BatchGitter sharing the batch process, that stores the
+// first error the embedded GitRunner can't return in *err.
+func (bg *BatchGitter) RecordErrors(err *error) Gitter {
+	return &BatchGitter{GitRunner: bg.GitRunner.withErrors(err), batchProcess: bg.batchProcess}
+}
+
+// Close stops the batch process. Calls made after Close start
+// git for each call, like GitRunner.
+func (bg *BatchGitter) Close() (err error) {
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+	if bg.cmd != nil {
+		_ = bg.stdin.Close()
+		err = bg.cmd.Wait()
+		bg.cancel()
+		bg.cmd = nil
+		bg.err = errBatchClosed
+	}
+	return
+}
+
+// lookup asks the batch process for the hash and type of the named object.
+// They are empty if the object doesn't exist. If the batch process can't
+// answer for the repository, ok is false.
+func (bg *BatchGitter) lookup(repo, name string) (hash, objtype string, ok bool) {
+	if repo != bg.repo || strings.ContainsAny(name, "\r\n") {
+		return
+	}
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+	if bg.err == nil {
+		start := time.Now()
+		var line string
+		var err error
+		if _, err = io.WriteString(bg.stdin, name+"\n"); err == nil {
+			if line, err = bg.stdout.ReadString('\n'); err == nil {
+				if fields := strings.Fields(line); len(fields) == 3 {
+					hash, objtype = fields[0], fields[1]
+				}
+				ok = true
+			}
+		}
+		if err != nil {
+			// fall back to running git for each call from now on
+			bg.err = &GitError{Args: batchArgs, Err: err}
+		}
+		if bg.OnRun != nil {
+			bg.OnRun(GitRun{Args: append(batchArgs[:len(batchArgs):len(batchArgs)], name), Duration: time.Since(start), Err: bg.err})
+		}
+	}
+	return
+}
+
+// GetTreeHash returns the tree hash for the given tag or commit.
+func (bg *BatchGitter) GetTreeHash(repo, tag string) string {
+	if hash, _, ok := bg.lookup(repo, tag+"^{tree}"); ok {
+		return hash
+	}
+	return bg.GitRunner.GetTreeHash(repo, tag)
+}
+
+// GetTagType returns "tag" for an annotated tag, "commit" for a lightweight tag, or an empty string.
+func (bg *BatchGitter) GetTagType(repo, tag string) string {
+	tag = strings.TrimPrefix(tag, "refs/")
+	tag = strings.TrimPrefix(tag, "tags/")
+	if _, objtype, ok := bg.lookup(repo, "refs/tags/"+tag); ok {
+		return objtype
+	}
+	return bg.GitRunner.GetTagType(repo, tag)
+}
+
+// GetCommit returns the commit hash for the given tag, branch or commit, or an empty string.
+func (bg *BatchGitter) GetCommit(repo, rev string) string {
+	if hash, _, ok := bg.lookup(repo, rev+"^{commit}"); ok {
+		return hash
+	}
+	return bg.GitRunner.GetCommit(repo, rev)
+}
@@ -0,0 +1,153 @@
+package makeversion
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func newTestBatchGitter(t testing.TB, repo string) (*GitRunner, *BatchGitter) {
+	t.Helper()
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dg := &GitRunner{Bin: gitBin}
+	bg, err := NewBatchGitter(dg, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dg, bg
+}
+
+func Test_BatchGitter_Lookups(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 3, map[int]string{1: "v1.0.0", 2: "av2.0.0"})
+	dg, bg := newTestBatchGitter(t, repo)
+	defer bg.Close()
+
+	names := []string{"v1.0.0", "v2.0.0", "HEAD", "main", "v3.0.0", "no such thing"}
+	for _, name := range names {
+		is.Equal(dg.GetTreeHash(repo, name), bg.GetTreeHash(repo, name))
+		is.Equal(dg.GetTagType(repo, name), bg.GetTagType(repo, name))
+		is.Equal(dg.GetCommit(repo, name), bg.GetCommit(repo, name))
+	}
+	is.Equal("tag", bg.GetTagType(repo, "v2.0.0"))
+	is.Equal("commit", bg.GetTagType(repo, "refs/tags/v1.0.0"))
+	is.True(bg.GetCommit(repo, "v2.0.0") != "")
+	is.Equal("", bg.GetTreeHash(repo, "v3.0.0"))
+
+	// other repositories run git for each call
+	other := makeTestRepo(t, 1, map[int]string{1: "v9.0.0"})
+	is.Equal(dg.GetTreeHash(other, "v9.0.0"), bg.GetTreeHash(other, "v9.0.0"))
+	is.True(bg.GetTreeHash(other, "v9.0.0") != "")
+
+	// RecordErrors shares the batch process
+	var gitErr error
+	view := bg.RecordErrors(&gitErr).(*BatchGitter)
+	is.Equal(bg.batchProcess, view.batchProcess)
+	is.Equal(dg.GetTreeHash(repo, "v1.0.0"), view.GetTreeHash(repo, "v1.0.0"))
+	is.NoErr(gitErr)
+
+	is.NoErr(bg.Close())
+	is.NoErr(bg.Close())
+	is.Equal(dg.GetTreeHash(repo, "v1.0.0"), bg.GetTreeHash(repo, "v1.0.0"))
+}
+
+func Test_BatchGitter_Concurrent(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 5, map[int]string{1: "v1.0.0", 2: "v2.0.0", 3: "av3.0.0", 4: "v4.0.0", 5: "av5.0.0"})
+	dg, bg := newTestBatchGitter(t, repo)
+	defer bg.Close()
+
+	want := make(map[string]string)
+	for _, tag := range dg.GetTags(repo) {
+		want[tag] = dg.GetTreeHash(repo, tag)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan string, 8*50)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tag := fmt.Sprintf("v%d.0.0", j%5+1)
+				if got := bg.GetTreeHash(repo, tag); got != want[tag] {
+					errs <- fmt.Sprintf("%s: %q != %q", tag, got, want[tag])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	is.NoErr(bg.Close())
+}
+
+// makeBenchRepo creates a repository with the given number of commits
+// and lightweight tags. No tag is on HEAD, so finding a tag with the
+// current tree has to look at all of them.
+func makeBenchRepo(b *testing.B, commits, tags int) string {
+	b.Helper()
+	repo := makeTestRepo(b, commits, nil)
+	hashes := strings.Fields(runGit(b, repo, "rev-list", "HEAD"))
+	for i := 0; i < tags; i++ {
+		fileName := filepath.Join(repo, ".git", "refs", "tags", fmt.Sprintf("v%d.%d.0", i/100, i%100))
+		if err := os.WriteFile(fileName, []byte(hashes[1+i%(len(hashes)-1)]+"\n"), 0600); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func benchmarkGetVersion(b *testing.B, git Gitter, repo string) {
+	vs := &VersionStringer{Git: git, Env: MockEnvironment{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := vs.GetVersion(repo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_GitRunner_GetVersion(b *testing.B) {
+	repo := makeBenchRepo(b, 20, 2000)
+	dg, bg := newTestBatchGitter(b, repo)
+	bg.Close()
+	benchmarkGetVersion(b, dg, repo)
+}
+
+func Benchmark_BatchGitter_GetVersion(b *testing.B) {
+	repo := makeBenchRepo(b, 20, 2000)
+	_, bg := newTestBatchGitter(b, repo)
+	defer bg.Close()
+	benchmarkGetVersion(b, bg, repo)
+}
+
+func Benchmark_GitRunner_GetTreeHash(b *testing.B) {
+	repo := makeBenchRepo(b, 20, 100)
+	dg, bg := newTestBatchGitter(b, repo)
+	bg.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dg.GetTreeHash(repo, "v0.1.0")
+	}
+}
+
+func Benchmark_BatchGitter_GetTreeHash(b *testing.B) {
+	repo := makeBenchRepo(b, 20, 100)
+	_, bg := newTestBatchGitter(b, repo)
+	defer bg.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bg.GetTreeHash(repo, "v0.1.0")
+	}
+}
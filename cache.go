@@ -0,0 +1,292 @@
+package makeversion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheMaxAge is how long unused cache entries are kept.
+const DefaultCacheMaxAge = 7 * 24 * time.Hour
+
+// CachedVersionStringer is a VersionStringer that stores the versions it
+// computes on disk, so repeated invocations for the same repository state
+// return at once. Entries are keyed by HEAD, the state of the index and refs
+// files, the configuration and the environment variables consulted while
+// computing the version. The key is found without running git, unless the
+// configuration has a DirtyMarker, which needs one git command.
+type CachedVersionStringer struct {
+	*VersionStringer
+	Dir string // cache directory, defaults to GitCacheDir for the repository
+}
+
+// cacheEntry is the content of a cache file.
+type cacheEntry struct {
+	Env     map[string]*string `json:"env"`             // environment variables consulted, nil if not set
+	Event   string             `json:"event,omitempty"` // hash of the GitHub event payload, if any
+	Version VersionInfo        `json:"version"`
+}
+
+// GitCacheDir returns the cache directory inside the repository's git directory.
+// For a linked worktree, that is the git directory of the main worktree.
+func GitCacheDir(repo string) string {
+	if _, commonDir, err := gitDirs(repo); err == nil {
+		return filepath.Join(commonDir, "makeversion")
+	}
+	return filepath.Join(repo, ".git", "makeversion")
+}
+
+// gitDirs returns the git directory of the working tree containing dir, and
+// the common git directory holding the refs, which is another one for linked
+// worktrees. A '.git' file, as used by worktrees and submodules, is followed.
+func gitDirs(dir string) (gitDir, commonDir string, err error) {
+	if dir, err = filepath.Abs(dir); err == nil {
+		for {
+			gitDir = filepath.Join(dir, ".git")
+			var fi os.FileInfo
+			if fi, err = os.Stat(gitDir); err == nil {
+				if !fi.IsDir() {
+					gitDir, err = readGitFile(gitDir)
+				}
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return "", "", errors.New("can't find .git")
+			}
+			dir = parent
+		}
+	}
+	if err == nil {
+		commonDir = gitDir
+		if b, e := os.ReadFile(filepath.Join(gitDir, "commondir")); e == nil /* #nosec G304 */ {
+			commonDir = relativeTo(gitDir, strings.TrimSpace(string(b)))
+		}
+	}
+	return
+}
+
+// readGitFile returns the git directory a '.git' file points to.
+func readGitFile(fileName string) (gitDir string, err error) {
+	var b []byte
+	if b, err = os.ReadFile(filepath.Clean(fileName)); err == nil /* #nosec G304 */ {
+		line := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(line, "gitdir:") {
+			return "", fmt.Errorf("%s: no gitdir line", fileName)
+		}
+		gitDir = relativeTo(filepath.Dir(fileName), strings.TrimSpace(strings.TrimPrefix(line, "gitdir:")))
+	}
+	return
+}
+
+// relativeTo returns name, resolved relative to dir unless it is absolute.
+func relativeTo(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// UserCacheDir returns a cache directory for the repository in the user cache directory.
+func UserCacheDir(repo string) (dir string, err error) {
+	if dir, err = os.UserCacheDir(); err == nil {
+		if repo, err = filepath.Abs(repo); err == nil {
+			sum := sha256.Sum256([]byte(repo))
+			dir = filepath.Join(dir, "makeversion", hex.EncodeToString(sum[:8]))
+		}
+	}
+	return
+}
+
+// GetVersion returns the cached version for the current state of the
+// repository if there is one, else it computes and caches it.
+func (cvs *CachedVersionStringer) GetVersion(repo string) (vi VersionInfo, err error) {
+	dir := cvs.Dir
+	if dir == "" {
+		dir = GitCacheDir(repo)
+	}
+	fileName := ""
+	if key := cvs.cacheKey(repo); key != "" {
+		fileName = filepath.Join(dir, key+".json")
+		if entry := cvs.readEntry(fileName); entry != nil {
+			now := time.Now()
+			_ = os.Chtimes(fileName, now, now)
+			cvs.explain(ExplainVersion, "cache", entry.Version.Version, "cached in %s", fileName)
+			return entry.Version, nil
+		}
+	}
+	env := &recordingEnv{Environment: cvs.Env, seen: make(map[string]*string)}
+	vs := *cvs.VersionStringer
+	vs.Env = env
+	if vi, err = vs.GetVersion(repo); err == nil && fileName != "" {
+		values := env.values()
+		entry := cacheEntry{Env: values, Event: eventHash(values), Version: vi}
+		cvs.writeEntry(dir, fileName, &entry)
+	}
+	return
+}
+
+// cacheKey returns a hash of the repository state, or an empty
+// string if it can't be determined.
+func (cvs *CachedVersionStringer) cacheKey(repo string) string {
+	gitDir, commonDir, err := gitDirs(repo)
+	if err != nil {
+		return ""
+	}
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD")) /* #nosec G304 */
+	if err != nil {
+		return ""
+	}
+	config, _ := json.Marshal(cvs.Config)
+	parts := []string{string(head), string(config), refsState(commonDir), refsState(gitDir)}
+	if fi, err := os.Stat(filepath.Join(gitDir, "index")); err == nil {
+		parts = append(parts, fileState(fi))
+	}
+	if cvs.GetConfig().DirtyMarker != "" {
+		parts = append(parts, strconv.FormatBool(isDirty(cvs.Git, repo)))
+	}
+
+	h := sha256.New()
+	for _, s := range parts {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileState describes a file by it's size and modification time.
+func fileState(fi os.FileInfo) string {
+	return strconv.FormatInt(fi.Size(), 10) + ":" + strconv.FormatInt(fi.ModTime().UnixNano(), 10)
+}
+
+// refsState describes the refs in the git directory by the number, size
+// and modification time of the ref files, so it changes if any of them do.
+func refsState(gitDir string) string {
+	var count, size int64
+	var latest time.Time
+	add := func(fi os.FileInfo) {
+		count++
+		size += fi.Size()
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(gitDir, "packed-refs")); err == nil {
+		add(fi)
+	}
+	_ = filepath.Walk(filepath.Join(gitDir, "refs"), func(_ string, fi os.FileInfo, err error) error {
+		if err == nil {
+			add(fi)
+		}
+		return nil
+	})
+	return strconv.FormatInt(count, 10) + ":" + strconv.FormatInt(size, 10) + ":" + strconv.FormatInt(latest.UnixNano(), 10)
+}
+
+// eventHash returns a hash of the GitHub event payload file, if it was consulted.
+func eventHash(env map[string]*string) string {
+	if fileName := env["GITHUB_EVENT_PATH"]; fileName != nil && *fileName != "" {
+		if b, err := os.ReadFile(filepath.Clean(*fileName)); err == nil /* #nosec G304 */ {
+			sum := sha256.Sum256(b)
+			return hex.EncodeToString(sum[:])
+		}
+	}
+	return ""
+}
+
+// readEntry returns the cache entry in the file, if it is still valid
+// for the current environment.
+func (cvs *CachedVersionStringer) readEntry(fileName string) *cacheEntry {
+	b, err := os.ReadFile(filepath.Clean(fileName)) /* #nosec G304 */
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if json.Unmarshal(b, &entry) != nil {
+		return nil
+	}
+	for key, want := range entry.Env {
+		got, ok := cvs.Env.LookupEnv(key)
+		if ok != (want != nil) || (ok && got != *want) {
+			return nil
+		}
+	}
+	if eventHash(entry.Env) != entry.Event {
+		return nil
+	}
+	return &entry
+}
+
+// writeEntry writes the cache entry, and removes entries unused for DefaultCacheMaxAge.
+// Errors are ignored, since the cache is only an optimization.
+func (cvs *CachedVersionStringer) writeEntry(dir, fileName string, entry *cacheEntry) {
+	if err := os.MkdirAll(dir, 0750); err == nil {
+		if b, err := json.Marshal(entry); err == nil {
+			tmpName := fileName + ".tmp" + strconv.Itoa(os.Getpid())
+			if err = os.WriteFile(tmpName, b, 0600); err == nil {
+				if os.Rename(tmpName, fileName) != nil {
+					_ = os.Remove(tmpName)
+				}
+			}
+		}
+		if names, err := filepath.Glob(filepath.Join(dir, "*.json")); err == nil {
+			for _, name := range names {
+				if fi, err := os.Stat(name); err == nil && time.Since(fi.ModTime()) > DefaultCacheMaxAge {
+					_ = os.Remove(name)
+				}
+			}
+		}
+	}
+}
+
+// recordingEnv is an Environment that remembers the variables looked up.
+type recordingEnv struct {
+	Environment
+	mu     sync.Mutex
+	seen   map[string]*string
+	only   func(key string) bool // if not nil, only these variables are remembered
+	redact func(key string) bool // if not nil, these variables are remembered as empty
+}
+
+func (re *recordingEnv) Getenv(key string) string {
+	val, _ := re.LookupEnv(key)
+	return val
+}
+
+func (re *recordingEnv) LookupEnv(key string) (val string, ok bool) {
+	val, ok = re.Environment.LookupEnv(key)
+	if re.only != nil && !re.only(key) {
+		return
+	}
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	if ok {
+		v := val
+		if re.redact != nil && re.redact(key) {
+			v = ""
+		}
+		re.seen[key] = &v
+	} else {
+		re.seen[key] = nil
+	}
+	return
+}
+
+// values returns a copy of the variables looked up.
+func (re *recordingEnv) values() map[string]*string {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	values := make(map[string]*string, len(re.seen))
+	for key, val := range re.seen {
+		values[key] = val
+	}
+	return values
+}
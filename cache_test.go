@@ -0,0 +1,138 @@
+package makeversion
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_CachedVersionStringer_GetVersion(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo := makeTestRepo(t, 2, map[int]string{1: "av1.0.0"})
+	env := MockEnvironment{}
+	cvs := &CachedVersionStringer{VersionStringer: &VersionStringer{Git: dg, Env: env}, Dir: t.TempDir()}
+
+	vi, err := cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2", vi.Version)
+	names, _ := filepath.Glob(filepath.Join(cvs.Dir, "*.json"))
+	is.Equal(1, len(names))
+
+	cvs.Explain = &Explanation{}
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2", vi.Version)
+	is.Equal(1, len(cvs.Explain.Find(ExplainVersion, "cache")))
+
+	// a changed environment variable invalidates the entry
+	env["GITHUB_RUN_NUMBER"] = "17"
+	cvs.Explain = &Explanation{}
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.17", vi.Version)
+	is.Equal(0, len(cvs.Explain.Find(ExplainVersion, "cache")))
+	delete(env, "GITHUB_RUN_NUMBER")
+
+	// so do new tags and commits
+	runGit(t, repo, "tag", "v1.1.0")
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.1.0", vi.Version)
+	is.NoErr(os.WriteFile(filepath.Join(repo, "file.txt"), []byte("changed"), 0600))
+	runGit(t, repo, "commit", "-q", "-a", "-m", "changed")
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.1.0-main.3", vi.Version)
+
+	// and so does changing the index
+	runGit(t, repo, "rm", "-q", "file.txt")
+	cvs.Config = &Config{DirtyMarker: "dirty"}
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.1.0-main.3+dirty", vi.Version)
+
+	cvs.Dir = ""
+	_, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	names, _ = filepath.Glob(filepath.Join(GitCacheDir(repo), "*.json"))
+	is.Equal(1, len(names))
+}
+
+func Test_CachedVersionStringer_cacheKey(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 2, map[int]string{1: "av1.0.0"})
+	var runs []GitRun
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	dg.(*GitRunner).OnRun = func(gr GitRun) { runs = append(runs, gr) }
+	cvs := &CachedVersionStringer{VersionStringer: &VersionStringer{Git: dg, Env: MockEnvironment{}}, Dir: t.TempDir()}
+
+	key := cvs.cacheKey(repo)
+	is.True(key != "")
+	is.Equal(0, len(runs))
+	is.Equal(key, cvs.cacheKey(filepath.Join(repo, ".git", "..")))
+
+	// a dirty marker needs to know about unstaged changes
+	cvs.Config = &Config{DirtyMarker: "dirty"}
+	vi, err := cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2", vi.Version)
+	is.NoErr(os.WriteFile(filepath.Join(repo, "file.txt"), []byte("changed"), 0600))
+	runs = nil
+	is.True(cvs.cacheKey(repo) != "")
+	is.Equal(1, len(runs))
+	vi, err = cvs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2+dirty", vi.Version)
+}
+
+func Test_CachedVersionStringer_Worktree(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo, err := filepath.EvalSymlinks(makeTestRepo(t, 2, map[int]string{1: "av1.0.0"}))
+	is.NoErr(err)
+	worktree := filepath.Join(t.TempDir(), "wt")
+	runGit(t, repo, "worktree", "add", "-q", "-b", "feature", worktree)
+
+	gitDir, commonDir, err := gitDirs(worktree)
+	is.NoErr(err)
+	is.Equal(filepath.Join(repo, ".git"), commonDir)
+	is.Equal(filepath.Join(repo, ".git", "worktrees", "wt"), gitDir)
+	is.Equal(GitCacheDir(repo), GitCacheDir(worktree))
+
+	cvs := &CachedVersionStringer{VersionStringer: &VersionStringer{Git: dg, Env: MockEnvironment{}}, Dir: t.TempDir()}
+	is.True(cvs.cacheKey(worktree) != cvs.cacheKey(repo))
+	key := cvs.cacheKey(worktree)
+	runGit(t, worktree, "commit", "-q", "--allow-empty", "-m", "in worktree")
+	is.True(cvs.cacheKey(worktree) != key)
+}
+
+func Test_CachedVersionStringer_NotARepo(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	repo := t.TempDir()
+	cvs := &CachedVersionStringer{VersionStringer: &VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{}}, Dir: dir}
+	vi, err := cvs.GetVersion(repo)
+	is.NoErr(err)
+	want, _ := cvs.VersionStringer.GetVersion(repo)
+	is.Equal(want, vi)
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	is.Equal(0, len(names))
+}
+
+func Test_UserCacheDir(t *testing.T) {
+	is := is.New(t)
+	dir1, err := UserCacheDir("/src/a")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir2, err := UserCacheDir("/src/b")
+	is.NoErr(err)
+	is.True(dir1 != dir2)
+	is.Equal("makeversion", filepath.Base(filepath.Dir(dir1)))
+}
@@ -0,0 +1,64 @@
+package makeversion
+
+// CI identifies a continuous integration system.
+type CI string
+
+const (
+	CINone       CI = ""
+	CIGitHub     CI = "github"
+	CIGitea      CI = "gitea"
+	CIForgejo    CI = "forgejo"
+	CIGitLab     CI = "gitlab"
+	CIBuildkite  CI = "buildkite"
+	CICircleCI   CI = "circleci"
+	CIWoodpecker CI = "woodpecker"
+	CIDrone      CI = "drone"
+	CIAzure      CI = "azure"
+	CITeamCity   CI = "teamcity"
+)
+
+// allCIs lists the CI systems we know about.
+var allCIs = []CI{
+	CIGitHub, CIGitea, CIForgejo, CIGitLab, CIBuildkite,
+	CICircleCI, CIWoodpecker, CIDrone, CIAzure, CITeamCity,
+}
+
+func isKnownCI(ci CI) bool {
+	for _, known := range allCIs {
+		if ci == known {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectCI returns the CI system we are running in, or CINone.
+//
+// Gitea and Forgejo Actions also set GITHUB_ACTIONS, so they
+// are checked for before GitHub. Likewise Woodpecker may set
+// Drone compatibility variables.
+func DetectCI(env Environment) CI {
+	switch {
+	case isEnvTrue(env, "FORGEJO_ACTIONS") || hasEnv(env, "FORGEJO_TOKEN"):
+		return CIForgejo
+	case isEnvTrue(env, "GITEA_ACTIONS"):
+		return CIGitea
+	case isEnvTrue(env, "GITHUB_ACTIONS"):
+		return CIGitHub
+	case isEnvTrue(env, "GITLAB_CI"):
+		return CIGitLab
+	case isEnvTrue(env, "BUILDKITE"):
+		return CIBuildkite
+	case isEnvTrue(env, "CIRCLECI"):
+		return CICircleCI
+	case env.Getenv("CI") == "woodpecker" || env.Getenv("CI_SYSTEM_NAME") == "woodpecker":
+		return CIWoodpecker
+	case isEnvTrue(env, "DRONE"):
+		return CIDrone
+	case isEnvTrue(env, "TF_BUILD"):
+		return CIAzure
+	case hasEnv(env, "TEAMCITY_VERSION"):
+		return CITeamCity
+	}
+	return CINone
+}
@@ -0,0 +1,23 @@
+package makeversion
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_DetectCI(t *testing.T) {
+	is := is.New(t)
+	is.Equal(CINone, DetectCI(MockEnvironment{}))
+	is.Equal(CIGitHub, DetectCI(MockEnvironment{"GITHUB_ACTIONS": "true"}))
+	is.Equal(CIGitea, DetectCI(MockEnvironment{"GITHUB_ACTIONS": "true", "GITEA_ACTIONS": "true"}))
+	is.Equal(CIForgejo, DetectCI(MockEnvironment{"GITHUB_ACTIONS": "true", "GITEA_ACTIONS": "true", "FORGEJO_TOKEN": "x"}))
+	is.Equal(CIForgejo, DetectCI(MockEnvironment{"FORGEJO_ACTIONS": "true"}))
+	is.Equal(CIGitLab, DetectCI(MockEnvironment{"GITLAB_CI": "true"}))
+	is.Equal(CIBuildkite, DetectCI(MockEnvironment{"BUILDKITE": "true"}))
+	is.Equal(CICircleCI, DetectCI(MockEnvironment{"CIRCLECI": "true"}))
+	is.Equal(CIWoodpecker, DetectCI(MockEnvironment{"CI": "woodpecker", "DRONE": "true"}))
+	is.Equal(CIDrone, DetectCI(MockEnvironment{"DRONE": "true"}))
+	is.Equal(CIAzure, DetectCI(MockEnvironment{"TF_BUILD": "True"}))
+	is.Equal(CITeamCity, DetectCI(MockEnvironment{"TEAMCITY_VERSION": "2023.05"}))
+}
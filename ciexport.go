@@ -0,0 +1,133 @@
+package makeversion
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDotEnv is the default name of the GitLab dotenv report file.
+const DefaultDotEnv = "makeversion.env"
+
+// CIExporter hands the version information over to a CI system,
+// so that later steps in the pipeline can use it.
+type CIExporter struct {
+	Env    Environment // environment, used to locate GitHub output files
+	Out    io.Writer   // where service messages are written
+	DotEnv string      // GitLab dotenv report file, defaults to DefaultDotEnv
+}
+
+type ciVar struct {
+	name  string // output name, e.g. "version"
+	title string // human readable name, e.g. "Version"
+	value string
+}
+
+func ciVars(vi *VersionInfo) []ciVar {
+	return []ciVar{
+		{"version", "Version", vi.Version},
+		{"tag", "Tag", vi.Tag},
+		{"branch", "Branch", vi.Branch},
+		{"build", "Build", vi.Build},
+		{"pullrequest", "Pull request", vi.PullRequest},
+	}
+}
+
+// envName returns the environment variable name for the output name.
+func (cv ciVar) envName() string {
+	return "MKVER_" + strings.ToUpper(cv.name)
+}
+
+// Export writes the version information in the way the given CI system expects.
+//
+// GitHub, Gitea and Forgejo get outputs and environment variables appended to
+// the files named by GITHUB_OUTPUT and GITHUB_ENV, and a table in GITHUB_STEP_SUMMARY.
+// GitLab gets a dotenv report file. Azure Pipelines and TeamCity get service
+// messages setting the build number and variables.
+func (ce *CIExporter) Export(ci CI, vi *VersionInfo) (err error) {
+	switch ci {
+	case CIGitHub, CIGitea, CIForgejo:
+		err = ce.exportGitHub(vi)
+	case CIGitLab:
+		err = ce.exportGitLab(vi)
+	case CIAzure:
+		err = ce.exportAzure(vi)
+	case CITeamCity:
+		err = ce.exportTeamCity(vi)
+	case CINone:
+		err = fmt.Errorf("no CI system detected")
+	default:
+		err = fmt.Errorf("exporting to %s is not supported", ci)
+	}
+	return
+}
+
+// appendFile appends the content to the file named by the environment
+// variable. Does nothing if the variable is not set.
+func (ce *CIExporter) appendFile(envvar, content string) (err error) {
+	if fileName := strings.TrimSpace(ce.Env.Getenv(envvar)); fileName != "" {
+		var f *os.File
+		if f, err = os.OpenFile(filepath.Clean(fileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil /* #nosec G304 */ {
+			defer f.Close()
+			_, err = f.WriteString(content)
+		}
+	}
+	return
+}
+
+func (ce *CIExporter) exportGitHub(vi *VersionInfo) (err error) {
+	var outputs, envs strings.Builder
+	summary := "| Name | Value |\n| --- | --- |\n"
+	for _, cv := range ciVars(vi) {
+		fmt.Fprintf(&outputs, "%s=%s\n", cv.name, cv.value)
+		fmt.Fprintf(&envs, "%s=%s\n", cv.envName(), cv.value)
+		summary += fmt.Sprintf("| %s | `%s` |\n", cv.title, cv.value)
+	}
+	if err = ce.appendFile("GITHUB_OUTPUT", outputs.String()); err == nil {
+		if err = ce.appendFile("GITHUB_ENV", envs.String()); err == nil {
+			err = ce.appendFile("GITHUB_STEP_SUMMARY", summary)
+		}
+	}
+	return
+}
+
+func (ce *CIExporter) exportGitLab(vi *VersionInfo) (err error) {
+	fileName := ce.DotEnv
+	if fileName == "" {
+		fileName = DefaultDotEnv
+	}
+	var sb strings.Builder
+	for _, cv := range ciVars(vi) {
+		fmt.Fprintf(&sb, "%s=%s\n", cv.envName(), cv.value)
+	}
+	return os.WriteFile(filepath.Clean(fileName), []byte(sb.String()), 0600)
+}
+
+// azureEscaper escapes text in ##vso service messages the way the Azure Pipelines agent unescapes it.
+var azureEscaper = strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", ";", "%3B", "]", "%5D")
+
+func (ce *CIExporter) exportAzure(vi *VersionInfo) (err error) {
+	if _, err = fmt.Fprintf(ce.Out, "##vso[build.updatebuildnumber]%s\n", azureEscaper.Replace(vi.Version)); err == nil {
+		for _, cv := range ciVars(vi) {
+			if _, err = fmt.Fprintf(ce.Out, "##vso[task.setvariable variable=%s]%s\n", cv.envName(), azureEscaper.Replace(cv.value)); err != nil {
+				break
+			}
+		}
+	}
+	return
+}
+
+var teamCityEscaper = strings.NewReplacer("|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]")
+
+func (ce *CIExporter) exportTeamCity(vi *VersionInfo) (err error) {
+	if _, err = fmt.Fprintf(ce.Out, "##teamcity[buildNumber '%s']\n", teamCityEscaper.Replace(vi.Version)); err == nil {
+		for _, cv := range ciVars(vi) {
+			if _, err = fmt.Fprintf(ce.Out, "##teamcity[setParameter name='env.%s' value='%s']\n", cv.envName(), teamCityEscaper.Replace(cv.value)); err != nil {
+				break
+			}
+		}
+	}
+	return
+}
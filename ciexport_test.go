@@ -0,0 +1,89 @@
+package makeversion
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+var testExportInfo = VersionInfo{
+	Tag:     "v1.2.3",
+	Branch:  "feature/x",
+	Build:   "45",
+	Version: "v1.2.3-feature-x.45",
+}
+
+func readTestFile(t *testing.T, fileName string) string {
+	t.Helper()
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_CIExporter_GitHub(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	env := MockEnvironment{
+		"GITHUB_OUTPUT":       filepath.Join(dir, "output"),
+		"GITHUB_ENV":          filepath.Join(dir, "env"),
+		"GITHUB_STEP_SUMMARY": filepath.Join(dir, "summary"),
+	}
+	is.NoErr(os.WriteFile(env["GITHUB_OUTPUT"], []byte("existing=1\n"), 0600))
+
+	ce := CIExporter{Env: env}
+	is.NoErr(ce.Export(CIGitHub, &testExportInfo))
+
+	output := readTestFile(t, env["GITHUB_OUTPUT"])
+	is.True(strings.HasPrefix(output, "existing=1\n"))
+	is.True(strings.Contains(output, "version=v1.2.3-feature-x.45\n"))
+	is.True(strings.Contains(output, "branch=feature/x\n"))
+	is.True(strings.Contains(readTestFile(t, env["GITHUB_ENV"]), "MKVER_BUILD=45\nMKVER_PULLREQUEST=\n"))
+	is.True(strings.Contains(readTestFile(t, env["GITHUB_STEP_SUMMARY"]), "| Version | `v1.2.3-feature-x.45` |\n"))
+
+	// missing files are skipped
+	ce.Env = MockEnvironment{}
+	is.NoErr(ce.Export(CIForgejo, &testExportInfo))
+}
+
+func Test_CIExporter_GitLab(t *testing.T) {
+	is := is.New(t)
+	fileName := filepath.Join(t.TempDir(), "build.env")
+	ce := CIExporter{Env: MockEnvironment{}, DotEnv: fileName}
+	is.NoErr(ce.Export(CIGitLab, &testExportInfo))
+	is.Equal(readTestFile(t, fileName), "MKVER_VERSION=v1.2.3-feature-x.45\nMKVER_TAG=v1.2.3\nMKVER_BRANCH=feature/x\nMKVER_BUILD=45\nMKVER_PULLREQUEST=\n")
+}
+
+func Test_CIExporter_Azure(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	ce := CIExporter{Env: MockEnvironment{}, Out: &buf}
+	is.NoErr(ce.Export(CIAzure, &VersionInfo{Version: "v1.0.0-100%"}))
+	is.True(strings.HasPrefix(buf.String(), "##vso[build.updatebuildnumber]v1.0.0-100%AZP25\n"))
+	is.True(strings.Contains(buf.String(), "##vso[task.setvariable variable=MKVER_VERSION]v1.0.0-100%AZP25\n"))
+
+	buf.Reset()
+	is.NoErr(ce.Export(CIAzure, &VersionInfo{Version: "v1.0.0", Branch: "a;b]c\r\n"}))
+	is.True(strings.Contains(buf.String(), "##vso[task.setvariable variable=MKVER_BRANCH]a%3Bb%5Dc%0D%0A\n"))
+}
+
+func Test_CIExporter_TeamCity(t *testing.T) {
+	is := is.New(t)
+	var buf bytes.Buffer
+	ce := CIExporter{Env: MockEnvironment{}, Out: &buf}
+	is.NoErr(ce.Export(CITeamCity, &VersionInfo{Version: "v1.0.0", Branch: "it's[x]"}))
+	is.True(strings.HasPrefix(buf.String(), "##teamcity[buildNumber 'v1.0.0']\n"))
+	is.True(strings.Contains(buf.String(), "##teamcity[setParameter name='env.MKVER_BRANCH' value='it|'s|[x|]']\n"))
+}
+
+func Test_CIExporter_Unsupported(t *testing.T) {
+	is := is.New(t)
+	ce := CIExporter{Env: MockEnvironment{}}
+	is.True(ce.Export(CINone, &testExportInfo) != nil)
+	is.True(ce.Export(CIBuildkite, &testExportInfo) != nil)
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cparta/makeversion/v2"
 )
@@ -22,22 +27,286 @@ func writeOutput(fileName, content string) (err error) {
 	return
 }
 
+// optionalValue is a string flag that may be given without a value,
+// in which case it is set to it's default value.
+type optionalValue struct {
+	value    string
+	defValue string
+}
+
+func (ov *optionalValue) String() string {
+	if ov == nil {
+		return ""
+	}
+	return ov.value
+}
+
+func (ov *optionalValue) Set(s string) error {
+	if s == "true" {
+		s = ov.defValue
+	} else if s == "false" {
+		s = ""
+	}
+	ov.value = s
+	return nil
+}
+
+func (ov *optionalValue) IsBoolFlag() bool {
+	return true
+}
+
+// listValue is a string flag that may be given several times,
+// each time with one or more comma separated values.
+type listValue []string
+
+func (lv *listValue) String() string {
+	if lv == nil {
+		return ""
+	}
+	return strings.Join(*lv, ",")
+}
+
+func (lv *listValue) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v != "" {
+			*lv = append(*lv, v)
+		}
+	}
+	return nil
+}
+
 var (
-	flagName  = flag.String("name", "", "write Go source with given package name")
-	flagRepo  = flag.String("repo", "", "repository to examine")
-	flagOut   = flag.String("out", "", "file path relative to repo to write to (defaults to stdout)")
-	flagGit   = flag.String("git", "git", "name of Git executable")
-	flagFetch = flag.Bool("fetch", false, "fetch remote tags")
+	flagUpdate  listValue
+	flagExplain = &optionalValue{defValue: "text"}
+	flagFetch   = &optionalValue{defValue: "tags"}
+	flagCache   = &optionalValue{defValue: "git"}
 )
 
+func init() {
+	flag.Var(flagExplain, "explain", "write an explanation of the versioning decisions to stderr, as 'text' or 'json'")
+	flag.Var(flagCache, "cache", "cache versions in the repository's .git directory ('git'), or the user cache directory ('user')")
+	flag.Var(&flagUpdate, "update", "set the version in the given manifest files relative to repo ("+strings.Join(makeversion.ManifestFiles(), ", ")+") instead of writing it")
+	flag.Var(flagFetch, "fetch", "fetch remote 'tags', or 'auto' to also deepen shallow clones until a version tag is reachable")
+}
+
+func fetch(vs *makeversion.VersionStringer, repoDir, mode string) (err error) {
+	opts := makeversion.FetchOptions{
+		Remote:    *flagFetchRemote,
+		Refspec:   *flagFetchRefspec,
+		PruneTags: *flagFetchPrune,
+		Depth:     *flagFetchDepth,
+		Timeout:   *flagFetchTimeout,
+	}
+	switch mode {
+	case "":
+	case "tags":
+		err = vs.FetchTags(repoDir, opts)
+	case "auto":
+		err = vs.FetchAuto(repoDir, opts)
+	default:
+		err = fmt.Errorf("unknown fetch mode %q", mode)
+	}
+	return
+}
+
+// versionGetter returns the function computing the version, which caches it if asked to.
+func versionGetter(vs *makeversion.VersionStringer, repoDir, mode string) (getVersion func(string) (makeversion.VersionInfo, error), err error) {
+	cvs := &makeversion.CachedVersionStringer{VersionStringer: vs}
+	switch mode {
+	case "":
+		getVersion = vs.GetVersion
+	case "git":
+		getVersion = cvs.GetVersion
+	case "user":
+		cvs.Dir, err = makeversion.UserCacheDir(repoDir)
+		getVersion = cvs.GetVersion
+	default:
+		err = fmt.Errorf("unknown cache location %q", mode)
+	}
+	return
+}
+
+func writeExplanation(ex *makeversion.Explanation, format string) (err error) {
+	content := ex.String()
+	switch format {
+	case "text":
+	case "json":
+		content, err = ex.JSON()
+	default:
+		err = fmt.Errorf("unknown explain format %q", format)
+	}
+	if err == nil {
+		_, err = os.Stderr.WriteString(content)
+	}
+	return
+}
+
+var (
+	flagName = flag.String("name", "", "write Go source with given package name")
+	flagRepo = flag.String("repo", "", "repository to examine")
+	flagOut  = flag.String("out", "", "file path relative to repo to write to (defaults to stdout)")
+	flagGit  = flag.String("git", "git", "name of Git executable")
+	flagCI   = flag.Bool("ci-export", false, "export the version to the detected CI system")
+	flagEnv  = flag.String("ci-dotenv", makeversion.DefaultDotEnv, "dotenv report file relative to repo to write on GitLab")
+	flagPR   = flag.String("pr-template", "", "version template for pull request builds")
+	flagCfg  = flag.String("config", "", "configuration file (defaults to "+makeversion.DefaultConfigFile+" in the repository)")
+	flagFmt  = flag.String("format", "", "write the version in the given format: "+strings.Join(formats, ", "))
+
+	flagGitTimeout = flag.Duration("git-timeout", 0, "stop each git command after this long, e.g. '10s'")
+	flagGitTrace   = flag.Bool("git-trace", false, "write each git command and it's duration to stderr")
+	flagGitBatch   = flag.Bool("git-batch", false, "look up tree hashes, tag types and commits through a long-lived 'git cat-file' process")
+	flagRecord     = flag.String("record", "", "record the git calls and CI environment variables used to a JSON fixture file, for bug reports")
+	flagTrustRepo  = flag.Bool("trust-repo", false, "let git work in the repository even if it is owned by another user")
+
+	flagUpdateDryRun = flag.Bool("update-dry-run", false, "write the changes -update would make as a diff, without changing the files")
+	flagUpdateCheck  = flag.Bool("update-check", false, "write the changes -update would make as a diff, and fail if there are any")
+
+	flagFetchRemote  = flag.String("fetch-remote", "", "remote to fetch tags from (defaults to origin)")
+	flagFetchRefspec = flag.String("fetch-refspec", "", "refspec to fetch, e.g. '+refs/tags/v*:refs/tags/v*'")
+	flagFetchPrune   = flag.Bool("fetch-prune", false, "remove local tags that no longer exist in the remote")
+	flagFetchDepth   = flag.Int("fetch-depth", 0, "deepen a shallow clone by this many commits when fetching tags")
+	flagFetchTimeout = flag.Duration("fetch-timeout", 0, "give up fetching after this long, e.g. '30s'")
+)
+
+// formats are the values accepted by -format.
+var formats = append(append([]string(nil), makeversion.Formats...), makeversion.FormatOCILabels, makeversion.FormatOCIAnnotations)
+
+// createdTime returns the time given by SOURCE_DATE_EPOCH, for
+// reproducible builds, or else the current time.
+func createdTime(env makeversion.Environment) (created time.Time, err error) {
+	created = time.Now()
+	if epoch := env.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		var sec int64
+		if sec, err = strconv.ParseInt(epoch, 10, 64); err == nil {
+			created = time.Unix(sec, 0)
+		} else {
+			err = fmt.Errorf("SOURCE_DATE_EPOCH: %q is not a number", epoch)
+		}
+	}
+	return
+}
+
+// ociAnnotations returns the OCI image annotations for the version
+// as label arguments or JSON.
+func ociAnnotations(vs *makeversion.VersionStringer, repoDir string, vi *makeversion.VersionInfo, format string) (content string, err error) {
+	var created time.Time
+	if created, err = createdTime(vs.Env); err == nil {
+		var revision string
+		if cr, ok := vs.Git.(makeversion.CommitResolver); ok {
+			revision = cr.GetCommit(repoDir, "HEAD")
+		}
+		annotations := vi.OCIAnnotations(revision, created)
+		if format == makeversion.FormatOCILabels {
+			content = makeversion.OCILabelArgs(annotations)
+		} else {
+			var b []byte
+			if b, err = json.MarshalIndent(annotations, "", "  "); err == nil {
+				content = string(b) + "\n"
+			}
+		}
+	}
+	return
+}
+
+// render returns Go source if a package name is given,
+// otherwise the version in the given format.
+func render(vs *makeversion.VersionStringer, repoDir string, vi *makeversion.VersionInfo, pkgName, format string) (content string, err error) {
+	if format == "" {
+		return vi.Render(pkgName)
+	}
+	if pkgName != "" {
+		return "", errors.New("-format can't be used with -name")
+	}
+	if format == makeversion.FormatOCILabels || format == makeversion.FormatOCIAnnotations {
+		return ociAnnotations(vs, repoDir, vi, format)
+	}
+	if format == makeversion.FormatOCITags {
+		var tags []string
+		if tags, err = vi.OCITags(vs.OCITagOptions(repoDir, vi)); err == nil {
+			content = strings.Join(tags, "\n") + "\n"
+		}
+		return
+	}
+	if format == makeversion.FormatWindows || format == makeversion.FormatGoVersion {
+		if _, clamped, _ := vi.WindowsVersion(); clamped {
+			fmt.Fprintf(os.Stderr, "warning: build %s is larger than %d, the largest allowed in Windows versions\n", vi.Build, makeversion.MaxWindowsVersionPart)
+		}
+	}
+	if content, err = vi.Format(format); err == nil {
+		content += "\n"
+	}
+	return
+}
+
+// repoPath returns the file name, with environment variables
+// expanded, relative to the repository unless it is absolute.
+func repoPath(repoDir, fileName string) string {
+	if fileName = os.ExpandEnv(fileName); !path.IsAbs(fileName) {
+		fileName = path.Join(repoDir, fileName)
+	}
+	return fileName
+}
+
+// update sets the version in the manifest files. In dry-run or check mode,
+// it writes the changes as a diff instead, and in check mode it returns an
+// error if any file needs changing.
+func update(repoDir string, vi *makeversion.VersionInfo, fileNames []string) (err error) {
+	var changed []string
+	for _, fileName := range fileNames {
+		fileName = repoPath(repoDir, fileName)
+		var mu *makeversion.ManifestUpdate
+		if mu, err = makeversion.UpdateManifest(fileName, vi); err != nil {
+			return
+		}
+		if mu.Changed() {
+			changed = append(changed, fileName)
+			if *flagUpdateDryRun || *flagUpdateCheck {
+				_, err = os.Stdout.WriteString(mu.Diff())
+			} else {
+				err = mu.Write()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	if *flagUpdateCheck && len(changed) > 0 {
+		err = fmt.Errorf("version %s not set in %s", vi.Version, strings.Join(changed, ", "))
+	}
+	return
+}
+
+// doctor prints the problems found in the repository, and
+// returns an error if any of them are errors.
+func doctor(vs *makeversion.VersionStringer, repoDir string) (err error) {
+	findings := vs.Doctor(repoDir)
+	for _, f := range findings {
+		fmt.Println(f.String())
+		if f.Severity == makeversion.SeverityError {
+			err = errors.New("problems found")
+		}
+	}
+	if len(findings) == 0 {
+		fmt.Println("no problems found")
+	}
+	return
+}
+
 func main() {
 	flag.Parse()
 
+	// "mkver doctor [flags] [repo]" checks the repository for problems.
+	isDoctor := flag.Arg(0) == "doctor"
+	if isDoctor {
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
 	var err error
 	var repoDir string
 	var vs *makeversion.VersionStringer
 	var vi makeversion.VersionInfo
 	var content string
+	var rg *makeversion.RecordingGitter
 
 	if repoDir = os.ExpandEnv(*flagRepo); repoDir == "" {
 		if repoDir = flag.Arg(0); repoDir == "" {
@@ -45,25 +314,78 @@ func main() {
 		}
 	}
 
-	if vs, err = makeversion.NewVersionStringer(*flagGit); err == nil {
-		if repoDir, err = vs.Git.CheckGitRepo(repoDir); err == nil {
-			if *flagFetch {
-				err = vs.Git.FetchTags(repoDir)
+	if vs, err = makeversion.NewVersionStringerWithConfig(*flagGit, repoDir, os.ExpandEnv(*flagCfg)); err == nil {
+		if *flagPR != "" {
+			if vs.Config == nil {
+				vs.Config = &makeversion.Config{}
+			}
+			vs.Config.PullRequestTemplate = *flagPR
+		}
+		if flagExplain.value != "" {
+			vs.Explain = &makeversion.Explanation{}
+		}
+		if dg, ok := vs.Git.(*makeversion.GitRunner); ok {
+			dg.Timeout = *flagGitTimeout
+			dg.TrustRepo = *flagTrustRepo
+			if *flagGitTrace {
+				dg.OnRun = func(gr makeversion.GitRun) { fmt.Fprintln(os.Stderr, gr.String()) }
+			}
+		}
+		if isDoctor {
+			err = doctor(vs, repoDir)
+		} else if repoDir, err = vs.Git.CheckGitRepo(repoDir); err == nil {
+			if dg, ok := vs.Git.(*makeversion.GitRunner); ok && *flagGitBatch {
+				var bg *makeversion.BatchGitter
+				if bg, err = makeversion.NewBatchGitter(dg, repoDir); err == nil {
+					defer bg.Close()
+					vs.Git = bg
+				}
+			}
+			if err == nil && *flagRecord != "" {
+				rg = makeversion.NewRecordingGitter(vs.Git)
+				vs.Git = rg
+				vs.Env = rg.Environment(vs.Env)
+			}
+			if err == nil {
+				err = fetch(vs, repoDir, flagFetch.value)
+			}
+			var getVersion func(string) (makeversion.VersionInfo, error)
+			if err == nil {
+				getVersion, err = versionGetter(vs, repoDir, flagCache.value)
 			}
 			if err == nil {
-				if vi, err = vs.GetVersion(repoDir); err == nil {
-					if content, err = vi.Render(*flagName); err == nil {
+				vi, err = getVersion(repoDir)
+				if vs.Explain != nil {
+					if e := writeExplanation(vs.Explain, flagExplain.value); err == nil {
+						err = e
+					}
+				}
+				if err == nil {
+					if len(flagUpdate) > 0 {
+						err = update(repoDir, &vi, flagUpdate)
+					} else if content, err = render(vs, repoDir, &vi, *flagName, *flagFmt); err == nil {
 						outpath := os.ExpandEnv(*flagOut)
 						if outpath != "" {
 							outpath = path.Join(repoDir, outpath)
 						}
 						err = writeOutput(outpath, content)
 					}
+					if err == nil && *flagCI {
+						ce := makeversion.CIExporter{Env: vs.Env, Out: os.Stdout, DotEnv: repoPath(repoDir, *flagEnv)}
+						err = ce.Export(makeversion.DetectCI(vs.Env), &vi)
+					}
 				}
 			}
 		}
 	}
 
+	if rg != nil {
+		// saved even if we failed, since that is when it's needed
+		if e := rg.Save(os.ExpandEnv(*flagRecord)); err == nil {
+			err = e
+		}
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%q: %v\n", repoDir, err.Error())
 		os.Exit(1)
@@ -0,0 +1,306 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/template"
+)
+
+// DefaultConfigFile is the name of the project configuration file.
+const DefaultConfigFile = ".makeversion.json"
+
+const (
+	// DefaultTagPrefix is the text that precedes the version number in version tags.
+	DefaultTagPrefix = "v"
+	// DefaultTagPattern is the glob pattern version tags must match.
+	DefaultTagPattern = DefaultTagPrefix + "[0-9]*"
+	// DefaultFallback is the version used when no version tag can be found.
+	DefaultFallback = "v0.0.0"
+	// DefaultTemplate is the text/template used to format the version of
+	// builds that aren't releases. It is executed with a TemplateData.
+	DefaultTemplate = `{{.Version}}{{with .Suffix}}-{{.}}{{end}}{{with .Dirty}}+{{.}}{{end}}`
+	// DefaultPullRequestTemplate is the text/template used to format the version
+	// of pull and merge request builds. It is executed with a TemplateData.
+	DefaultPullRequestTemplate = `{{.Version}}-pr.{{.PullRequest}}{{with .Build}}.{{.}}{{end}}`
+)
+
+// DefaultMaintenanceBranch is a suitable maintenance branch pattern, matching
+// branch names like "release/1.4", "hotfix/v1.4" or "maintenance/1.4.x".
+const DefaultMaintenanceBranch = `^(?:release|hotfix|maintenance)/v?(\d+)\.(\d+)(?:\.x)?$`
+
+// DefaultReleaseBranches are the branch names allowed to use release
+// mode, along with the configured ones, if the CI system doesn't tell
+// us the default branch.
+var DefaultReleaseBranches = []ReleaseBranch{{Pattern: "default"}, {Pattern: "master"}, {Pattern: "main"}}
+
+// Config holds the versioning policy for a project. It is normally
+// read from a DefaultConfigFile in the repository. Empty fields use
+// the defaults.
+type Config struct {
+	ReleaseBranches     []ReleaseBranch `json:"releaseBranches,omitempty"`     // release branch patterns, in addition to the default branch
+	TagPrefix           string          `json:"tagPrefix,omitempty"`           // text preceding the version number in tags, defaults to DefaultTagPrefix
+	TagPattern          string          `json:"tagPattern,omitempty"`          // glob pattern version tags must match, defaults to TagPrefix followed by "[0-9]*"
+	Template            string          `json:"template,omitempty"`            // version template, defaults to DefaultTemplate
+	PullRequestTemplate string          `json:"pullRequestTemplate,omitempty"` // pull request version template, defaults to DefaultPullRequestTemplate
+	DirtyMarker         string          `json:"dirtyMarker,omitempty"`         // marker for builds with uncommitted changes, none if empty
+	Fallback            string          `json:"fallback,omitempty"`            // version used when no tag is found, defaults to DefaultFallback
+	MaintenanceBranch   string          `json:"maintenanceBranch,omitempty"`   // regular expression capturing major and minor version from maintenance branch names
+	MaxBranchLength     int             `json:"maxBranchLength,omitempty"`     // longest branch text in versions, defaults to MaxBranchTextLength
+	CI                  map[CI]*Config  `json:"ci,omitempty"`                  // overrides used when running in the given CI system
+}
+
+// ConfigError describes a problem with a configuration file.
+type ConfigError struct {
+	File string // configuration file name
+	Key  string // offending key, e.g. "ci.github.tagPattern"
+	Err  error
+}
+
+func (ce *ConfigError) Error() string {
+	if ce.Key == "" {
+		return fmt.Sprintf("%s: %v", ce.File, ce.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", ce.File, ce.Key, ce.Err)
+}
+
+func (ce *ConfigError) Unwrap() error {
+	return ce.Err
+}
+
+// FindConfig looks for a DefaultConfigFile in the given directory
+// and it's parents. Returns the file name or an empty string.
+func FindConfig(dir string) string {
+	if dir, err := filepath.Abs(dir); err == nil {
+		for {
+			fileName := filepath.Join(dir, DefaultConfigFile)
+			if fi, err := os.Stat(fileName); err == nil && !fi.IsDir() {
+				return fileName
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return ""
+}
+
+// LoadConfig reads and validates the given configuration file.
+func LoadConfig(fileName string) (cfg *Config, err error) {
+	var b []byte
+	if b, err = os.ReadFile(filepath.Clean(fileName)); err == nil /* #nosec G304 */ {
+		cfg = &Config{}
+		if err = cfg.parse("", b); err != nil {
+			if ce, ok := err.(*ConfigError); ok {
+				ce.File = fileName
+			}
+			cfg = nil
+		}
+	}
+	return
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// parse decodes the JSON object in b one key at a time, so
+// that errors can name the offending key.
+func (cfg *Config) parse(prefix string, b []byte) (err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return &ConfigError{Key: prefix, Err: err}
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var dst interface{}
+		switch key {
+		case "releaseBranches":
+			dst = &cfg.ReleaseBranches
+		case "tagPrefix":
+			dst = &cfg.TagPrefix
+		case "tagPattern":
+			dst = &cfg.TagPattern
+		case "template":
+			dst = &cfg.Template
+		case "pullRequestTemplate":
+			dst = &cfg.PullRequestTemplate
+		case "dirtyMarker":
+			dst = &cfg.DirtyMarker
+		case "fallback":
+			dst = &cfg.Fallback
+		case "maintenanceBranch":
+			dst = &cfg.MaintenanceBranch
+		case "maxBranchLength":
+			dst = &cfg.MaxBranchLength
+		case "ci":
+			if prefix == "" {
+				if err = cfg.parseCI(key, raw[key]); err != nil {
+					return
+				}
+				continue
+			}
+		}
+		if dst == nil {
+			return &ConfigError{Key: joinKey(prefix, key), Err: fmt.Errorf("unknown key")}
+		}
+		if err = json.Unmarshal(raw[key], dst); err != nil {
+			return &ConfigError{Key: joinKey(prefix, key), Err: err}
+		}
+	}
+	return cfg.validate(prefix)
+}
+
+func (cfg *Config) parseCI(prefix string, b []byte) (err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return &ConfigError{Key: prefix, Err: err}
+	}
+	cfg.CI = make(map[CI]*Config)
+	for name, b := range raw {
+		key := joinKey(prefix, name)
+		if !isKnownCI(CI(name)) {
+			return &ConfigError{Key: key, Err: fmt.Errorf("unknown CI system")}
+		}
+		override := &Config{}
+		if err = override.parse(key, b); err != nil {
+			return
+		}
+		cfg.CI[CI(name)] = override
+	}
+	return
+}
+
+// Validate checks the configuration and its CI overrides, like reading it
+// from a file does. It is safe to call on a nil Config.
+func (cfg *Config) Validate() (err error) {
+	if cfg != nil {
+		if err = cfg.validate(""); err == nil {
+			names := make([]string, 0, len(cfg.CI))
+			for name := range cfg.CI {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if override := cfg.CI[CI(name)]; override != nil {
+					if err = override.validate(joinKey("ci", name)); err != nil {
+						break
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (cfg *Config) validate(prefix string) (err error) {
+	for i := range cfg.ReleaseBranches {
+		if err = cfg.ReleaseBranches[i].Validate(); err != nil {
+			return &ConfigError{Key: fmt.Sprintf("%s[%d]", joinKey(prefix, "releaseBranches"), i), Err: err}
+		}
+	}
+	if _, err = path.Match(cfg.TagPattern, ""); err != nil {
+		return &ConfigError{Key: joinKey(prefix, "tagPattern"), Err: err}
+	}
+	if cfg.MaintenanceBranch != "" {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(cfg.MaintenanceBranch); err == nil && re.NumSubexp() < 2 {
+			err = errors.New("must capture major and minor version")
+		}
+		if err != nil {
+			return &ConfigError{Key: joinKey(prefix, "maintenanceBranch"), Err: err}
+		}
+	}
+	if cfg.MaxBranchLength != 0 && (cfg.MaxBranchLength < MinBranchTextLength || cfg.MaxBranchLength > MaxDockerTagLength) {
+		err = fmt.Errorf("must be between %d and %d", MinBranchTextLength, MaxDockerTagLength)
+		return &ConfigError{Key: joinKey(prefix, "maxBranchLength"), Err: err}
+	}
+	for key, tmplText := range map[string]string{"template": cfg.Template, "pullRequestTemplate": cfg.PullRequestTemplate} {
+		if _, err = template.New(key).Parse(tmplText); err != nil {
+			return &ConfigError{Key: joinKey(prefix, key), Err: err}
+		}
+	}
+	return
+}
+
+// merge overwrites the fields in cfg with the non-empty fields in other.
+func (cfg *Config) merge(other *Config) {
+	if other.ReleaseBranches != nil {
+		cfg.ReleaseBranches = other.ReleaseBranches
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&cfg.TagPrefix, &other.TagPrefix},
+		{&cfg.TagPattern, &other.TagPattern},
+		{&cfg.Template, &other.Template},
+		{&cfg.PullRequestTemplate, &other.PullRequestTemplate},
+		{&cfg.DirtyMarker, &other.DirtyMarker},
+		{&cfg.Fallback, &other.Fallback},
+		{&cfg.MaintenanceBranch, &other.MaintenanceBranch},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if other.MaxBranchLength != 0 {
+		cfg.MaxBranchLength = other.MaxBranchLength
+	}
+}
+
+// setsTagPattern returns true if the configuration, with the overrides for
+// the given CI system, sets the tag pattern or the tag prefix.
+func (cfg *Config) setsTagPattern(ci CI) (set bool) {
+	if cfg != nil {
+		set = cfg.TagPattern != "" || cfg.TagPrefix != ""
+		if override, ok := cfg.CI[ci]; ok && override != nil {
+			set = set || override.TagPattern != "" || override.TagPrefix != ""
+		}
+	}
+	return
+}
+
+// Resolve returns a copy of the configuration with the overrides
+// for the given CI system applied and the defaults filled in, except
+// for ReleaseBranches which is left empty if not configured.
+// It doesn't check the configuration, see Validate.
+// It is safe to call on a nil Config.
+func (cfg *Config) Resolve(ci CI) (resolved Config) {
+	if cfg != nil {
+		resolved.merge(cfg)
+		if override, ok := cfg.CI[ci]; ok && override != nil {
+			resolved.merge(override)
+		}
+	}
+	if resolved.TagPrefix == "" {
+		resolved.TagPrefix = DefaultTagPrefix
+	}
+	if resolved.TagPattern == "" {
+		resolved.TagPattern = resolved.TagPrefix + "[0-9]*"
+	}
+	if resolved.Template == "" {
+		resolved.Template = DefaultTemplate
+	}
+	if resolved.PullRequestTemplate == "" {
+		resolved.PullRequestTemplate = DefaultPullRequestTemplate
+	}
+	if resolved.Fallback == "" {
+		resolved.Fallback = DefaultFallback
+	}
+	if resolved.MaxBranchLength == 0 {
+		resolved.MaxBranchLength = MaxBranchTextLength
+	}
+	return
+}
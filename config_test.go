@@ -0,0 +1,119 @@
+package makeversion
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), DefaultConfigFile)
+	if err := os.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func Test_FindConfig(t *testing.T) {
+	is := is.New(t)
+	expect, err := filepath.Abs("testdata/config/.makeversion.json")
+	is.NoErr(err)
+	is.Equal(expect, FindConfig("testdata/config/sub"))
+	is.Equal(expect, FindConfig("testdata/config"))
+	is.Equal("", FindConfig("testdata"))
+}
+
+func Test_LoadConfig(t *testing.T) {
+	is := is.New(t)
+	cfg, err := LoadConfig("testdata/config/.makeversion.json")
+	is.NoErr(err)
+	is.Equal([]ReleaseBranch{{Pattern: "main"}, {Pattern: "release/*"}}, cfg.ReleaseBranches)
+	is.Equal("myapp/v", cfg.TagPrefix)
+	is.Equal("dirty", cfg.DirtyMarker)
+	is.Equal([]ReleaseBranch{{Pattern: "stable"}}, cfg.CI[CIGitLab].ReleaseBranches)
+
+	_, err = LoadConfig("testdata/config/does-not-exist.json")
+	is.True(errors.Is(err, os.ErrNotExist))
+}
+
+func Test_LoadConfig_Errors(t *testing.T) {
+	is := is.New(t)
+	for content, key := range map[string]string{
+		`[]`:                                                "",
+		`{"tagPrefix": 1}`:                                  "tagPrefix",
+		`{"nosuchkey": 1}`:                                  "nosuchkey",
+		`{"releaseBranches": ["main", "[x"]}`:               "releaseBranches[1]",
+		`{"maintenanceBranch": "^release/"}`:                "maintenanceBranch",
+		`{"maintenanceBranch": "("}`:                        "maintenanceBranch",
+		`{"tagPattern": "v["}`:                              "tagPattern",
+		`{"maxBranchLength": 4}`:                            "maxBranchLength",
+		`{"ci": {"github": {"maxBranchLength": 200}}}`:      "ci.github.maxBranchLength",
+		`{"template": "{{.Version"}`:                        "template",
+		`{"ci": {"jenkins": {}}}`:                           "ci.jenkins",
+		`{"ci": {"github": {"fallback": true}}}`:            "ci.github.fallback",
+		`{"ci": {"github": {"ci": {}}}}`:                    "ci.github.ci",
+		`{"ci": {"github": {"pullRequestTemplate": "{{"}}}`: "ci.github.pullRequestTemplate",
+	} {
+		fileName := writeTestConfig(t, content)
+		_, err := LoadConfig(fileName)
+		var ce *ConfigError
+		is.True(errors.As(err, &ce))
+		is.Equal(key, ce.Key)
+		is.Equal(fileName, ce.File)
+		is.True(strings.HasPrefix(err.Error(), fileName+": "+key))
+	}
+}
+
+func Test_Config_Resolve(t *testing.T) {
+	is := is.New(t)
+	var cfg *Config
+	resolved := cfg.Resolve(CINone)
+	is.Equal(0, len(resolved.ReleaseBranches))
+	is.Equal(DefaultTagPrefix, resolved.TagPrefix)
+	is.Equal(DefaultTagPattern, resolved.TagPattern)
+	is.Equal(DefaultTemplate, resolved.Template)
+	is.Equal(DefaultPullRequestTemplate, resolved.PullRequestTemplate)
+	is.Equal(DefaultFallback, resolved.Fallback)
+	is.Equal("", resolved.DirtyMarker)
+	is.Equal(MaxBranchTextLength, resolved.MaxBranchLength)
+
+	cfg, err := LoadConfig("testdata/config/.makeversion.json")
+	is.NoErr(err)
+	resolved = cfg.Resolve(CIGitHub)
+	is.Equal(2, len(resolved.ReleaseBranches))
+	is.Equal("myapp/v[0-9]*", resolved.TagPattern)
+	is.Equal("v0.1.0", resolved.Fallback)
+	resolved = cfg.Resolve(CIGitLab)
+	is.Equal([]ReleaseBranch{{Pattern: "stable"}}, resolved.ReleaseBranches)
+	is.Equal("myapp/v", resolved.TagPrefix)
+}
+
+func Test_Config_Validate(t *testing.T) {
+	is := is.New(t)
+	var cfg *Config
+	is.NoErr(cfg.Validate())
+	cfg, err := LoadConfig("testdata/config/.makeversion.json")
+	is.NoErr(err)
+	is.NoErr(cfg.Validate())
+
+	cfg = &Config{ReleaseBranches: []ReleaseBranch{{Pattern: "main"}, {Channel: "rc"}}}
+	err = cfg.Validate()
+	ce, ok := err.(*ConfigError)
+	is.True(ok)
+	is.Equal("releaseBranches[1]", ce.Key)
+
+	cfg = &Config{CI: map[CI]*Config{CIGitLab: {ReleaseBranches: []ReleaseBranch{{Regex: "("}}}}}
+	err = cfg.Validate()
+	ce, ok = err.(*ConfigError)
+	is.True(ok)
+	is.Equal("ci.gitlab.releaseBranches[0]", ce.Key)
+
+	vs := VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{}, Config: cfg}
+	_, err = vs.GetVersion(".")
+	is.Equal(ce, err)
+}
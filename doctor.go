@@ -0,0 +1,122 @@
+package makeversion
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Severities of a doctor Finding.
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Finding is a problem found by Doctor.
+type Finding struct {
+	Check    string // name of the check, e.g. "shallow"
+	Severity string // one of the Severity... constants
+	Message  string // what is wrong
+	Hint     string // how to fix it
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s: %s: %s", f.Severity, f.Check, f.Message)
+	if f.Hint != "" {
+		s += "\n  hint: " + f.Hint
+	}
+	return s
+}
+
+// Doctor examines the repository for common problems that
+// lead to wrong versions, and returns what it finds.
+func (vs *VersionStringer) Doctor(dir string) (findings []Finding) {
+	add := func(check, severity, hint, format string, args ...interface{}) {
+		findings = append(findings, Finding{Check: check, Severity: severity, Message: fmt.Sprintf(format, args...), Hint: hint})
+	}
+
+	var de *DubiousOwnershipError
+	repo, err := vs.Git.CheckGitRepo(dir)
+	if err == nil {
+		if err = checkAccess(vs.Git, repo); err != nil && !errors.As(err, &de) {
+			add("access", SeverityError, "", "git fails in %q: %v", repo, err)
+			return
+		}
+	}
+	if errors.As(err, &de) {
+		add("ownership", SeverityError,
+			fmt.Sprintf("run 'git config --global --add safe.directory %s', or use mkver -trust-repo", de.Repo),
+			"git refuses to work in %q because it is owned by another user", de.Repo)
+		return
+	}
+	if err != nil {
+		add("repository", SeverityError, "run mkver in a git working tree, or use -repo",
+			"%q is not in a git repository: %v", dir, err)
+		return
+	}
+
+	cfg := vs.GetConfig()
+	closest := closestTag(vs.Git, repo, "HEAD", cfg.TagPattern)
+	if isShallow(vs.Git, repo) {
+		if closest == "" {
+			add("shallow", SeverityError,
+				"run 'git fetch --unshallow --tags', use mkver -fetch=auto, or set 'fetch-depth: 0' for actions/checkout",
+				"the repository is a shallow clone and no tag matching %q is reachable from HEAD", cfg.TagPattern)
+		} else {
+			add("shallow", SeverityWarning,
+				"run 'git fetch --unshallow', or set 'fetch-depth: 0' for actions/checkout",
+				"the repository is a shallow clone, so the commit count used as build number is wrong")
+		}
+	} else if closest == "" {
+		add("tags", SeverityWarning, fmt.Sprintf("create a version tag, e.g. 'git tag -a %s0.1.0'", cfg.TagPrefix),
+			"no tag matching %q is reachable from HEAD, so the version will be %q", cfg.TagPattern, cfg.Fallback)
+	}
+
+	if _, branchName := vs.GetBranch(repo); branchName == "" {
+		add("detached", SeverityWarning, "check out a branch, or run in a CI system that tells us the branch",
+			"HEAD is detached and there is no branch information from a CI system")
+	}
+
+	var versionTags, lightweight []string
+	for _, tag := range vs.Git.GetTags(repo) {
+		if ok, _ := path.Match(cfg.TagPattern, tag); ok {
+			versionTags = append(versionTags, tag)
+			if _, err := ParseSemver(DefaultTagPrefix + strings.TrimPrefix(tag, cfg.TagPrefix)); err != nil {
+				add("semver", SeverityWarning, "delete or rename the tag, or narrow tagPattern in the configuration",
+					"tag %q matches %q but is not a semantic version", tag, cfg.TagPattern)
+			}
+			if getTagType(vs.Git, repo, tag) == "commit" {
+				lightweight = append(lightweight, tag)
+			}
+		}
+	}
+	if len(lightweight) > 0 {
+		add("lightweight", SeverityInfo, "use annotated tags ('git tag -a'), which record who tagged and when",
+			"lightweight version tags: %s", strings.Join(lightweight, ", "))
+	}
+
+	if len(versionTags) > 0 {
+		if remoteTags, err := getRemoteTags(vs.Git, repo, ""); err != nil {
+			add("remote", SeverityWarning, "check the 'origin' remote and your credentials",
+				"can't list remote tags: %v", err)
+		} else {
+			remote := make(map[string]bool)
+			for _, tag := range remoteTags {
+				remote[tag] = true
+			}
+			var missing []string
+			for _, tag := range versionTags {
+				if !remote[tag] {
+					missing = append(missing, tag)
+				}
+			}
+			if len(missing) > 0 {
+				add("unpushed", SeverityWarning, "run 'git push origin --tags'",
+					"version tags missing from the remote: %s", strings.Join(missing, ", "))
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package makeversion
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func findCheck(findings []Finding, check string) *Finding {
+	for i := range findings {
+		if findings[i].Check == check {
+			return &findings[i]
+		}
+	}
+	return nil
+}
+
+func Test_VersionStringer_Doctor_Healthy(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{remoteTags: []string{"v6.0.0", "v4.0.0", "v2.0.0"}}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}}
+
+	findings := vs.Doctor(".")
+	is.Equal(1, len(findings))
+	f := findCheck(findings, "lightweight")
+	is.True(f != nil)
+	is.Equal(SeverityInfo, f.Severity)
+	is.Equal("lightweight version tags: v2.0.0", f.Message)
+}
+
+func Test_VersionStringer_Doctor_NotRepo(t *testing.T) {
+	is := is.New(t)
+	vs := VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{}}
+	findings := vs.Doctor("/")
+	is.Equal(1, len(findings))
+	is.Equal("repository", findings[0].Check)
+	is.Equal(SeverityError, findings[0].Severity)
+}
+
+func Test_VersionStringer_Doctor_DubiousOwnership(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{accessErr: &DubiousOwnershipError{Repo: "/src", Err: errors.New("fatal: detected dubious ownership in repository at '/src'")}}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}}
+
+	findings := vs.Doctor(".")
+	is.Equal(1, len(findings))
+	is.Equal("ownership", findings[0].Check)
+	is.True(strings.Contains(findings[0].Hint, "safe.directory"))
+
+	git.accessErr = os.ErrPermission
+	findings = vs.Doctor(".")
+	is.Equal(1, len(findings))
+	is.Equal("access", findings[0].Check)
+}
+
+func Test_VersionStringer_Doctor_Problems(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{shallow: true, remoteTags: []string{"v6.0.0"}}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}, Config: &Config{TagPattern: "v*"}}
+
+	findings := vs.Doctor(".")
+	f := findCheck(findings, "shallow")
+	is.True(f != nil)
+	is.Equal(SeverityError, f.Severity)
+	f = findCheck(findings, "unpushed")
+	is.True(f != nil)
+	is.Equal("version tags missing from the remote: v4.0.0, v2.0.0", f.Message)
+	is.True(strings.HasPrefix(f.String(), "warning: unpushed: version tags missing"))
+	is.True(strings.HasSuffix(f.String(), "\n  hint: run 'git push origin --tags'"))
+
+	git.remoteErr = errors.New("fatal: 'origin' does not appear to be a git repository")
+	findings = vs.Doctor(".")
+	is.True(findCheck(findings, "unpushed") == nil)
+	is.True(findCheck(findings, "remote") != nil)
+}
+
+func Test_VersionStringer_Doctor_NoTags(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{remoteTags: []string{}}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}, Config: &Config{TagPattern: "x*"}}
+
+	findings := vs.Doctor(".")
+	is.Equal(1, len(findings))
+	is.Equal("tags", findings[0].Check)
+	is.Equal(`no tag matching "x*" is reachable from HEAD, so the version will be "v0.0.0"`, findings[0].Message)
+}
+
+func Test_VersionStringer_Doctor_Semver(t *testing.T) {
+	is := is.New(t)
+	vs := VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{}}
+	findings := vs.Doctor(".")
+	is.True(findCheck(findings, "semver") == nil)
+
+	// tags are checked with the prefix replaced by "v"
+	vs.Config = &Config{TagPrefix: "v6", TagPattern: "v6*"}
+	findings = vs.Doctor(".")
+	f := findCheck(findings, "semver")
+	is.True(f != nil)
+	is.Equal(`tag "v6.0.0" matches "v6*" but is not a semantic version`, f.Message)
+}
@@ -1,6 +1,9 @@
 package makeversion
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 // Environment allows us to mock the OS environment
 type Environment interface {
@@ -18,3 +21,15 @@ func (OsEnvironment) Getenv(key string) string {
 func (OsEnvironment) LookupEnv(key string) (string, bool) {
 	return os.LookupEnv(key)
 }
+
+// isEnvTrue returns true if the given environment variable
+// exists and is set to the string "true" (not case sensitive).
+func isEnvTrue(env Environment, envvar string) bool {
+	return strings.ToLower(strings.TrimSpace(env.Getenv(envvar))) == "true"
+}
+
+// hasEnv returns true if the given environment variable exists.
+func hasEnv(env Environment, envvar string) (ok bool) {
+	_, ok = env.LookupEnv(envvar)
+	return
+}
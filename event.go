@@ -0,0 +1,58 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// GitHubEvent holds the parts of the GitHub Actions event payload
+// that we use. Gitea and Forgejo Actions write a compatible payload.
+type GitHubEvent struct {
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	PullRequest struct {
+		Number int `json:"number"`
+		Head   struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// IsPullRequest returns true if the event is for a pull request.
+func (ev *GitHubEvent) IsPullRequest() bool {
+	return ev.PullRequest.Number > 0
+}
+
+// readEventFile reads the event payload file.
+var readEventFile = os.ReadFile
+
+// gitHubEvent is the event payload read from a file.
+type gitHubEvent struct {
+	fileName string
+	ev       *GitHubEvent
+}
+
+// GetGitHubEvent reads the event payload file named by GITHUB_EVENT_PATH.
+// Returns nil if there is no such file or it can't be parsed. The file
+// is only read again if GITHUB_EVENT_PATH changes.
+func (vs *VersionStringer) GetGitHubEvent() (ev *GitHubEvent) {
+	fileName := vs.getenv("GITHUB_EVENT_PATH")
+	if vs.event != nil && vs.event.fileName == fileName {
+		return vs.event.ev
+	}
+	if fileName != "" {
+		if b, err := readEventFile(filepath.Clean(fileName)); err == nil /* #nosec G304 */ {
+			ev = &GitHubEvent{}
+			if json.Unmarshal(b, ev) != nil {
+				ev = nil
+			}
+		}
+	}
+	vs.event = &gitHubEvent{fileName: fileName, ev: ev}
+	return
+}
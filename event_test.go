@@ -0,0 +1,123 @@
+package makeversion
+
+import (
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_VersionStringer_GetGitHubEvent(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	vs := VersionStringer{Env: env}
+
+	is.Equal(vs.GetGitHubEvent(), nil)
+
+	env["GITHUB_EVENT_PATH"] = "testdata/does-not-exist.json"
+	is.Equal(vs.GetGitHubEvent(), nil)
+
+	env["GITHUB_EVENT_PATH"] = "versionstringer.go"
+	is.Equal(vs.GetGitHubEvent(), nil)
+
+	env["GITHUB_EVENT_PATH"] = "testdata/event-push.json"
+	ev := vs.GetGitHubEvent()
+	is.True(ev != nil)
+	is.Equal("trunk", ev.Repository.DefaultBranch)
+	is.True(!ev.IsPullRequest())
+
+	env["GITHUB_EVENT_PATH"] = "testdata/event-pull-request.json"
+	ev = vs.GetGitHubEvent()
+	is.True(ev != nil)
+	is.Equal("main", ev.Repository.DefaultBranch)
+	is.True(ev.IsPullRequest())
+	is.Equal(123, ev.PullRequest.Number)
+	is.Equal("feature/thing", ev.PullRequest.Head.Ref)
+	is.Equal("main", ev.PullRequest.Base.Ref)
+}
+
+func Test_VersionStringer_GetGitHubEvent_ReadsOnce(t *testing.T) {
+	is := is.New(t)
+	reads := 0
+	defer func(orig func(string) ([]byte, error)) { readEventFile = orig }(readEventFile)
+	readEventFile = func(fileName string) ([]byte, error) {
+		reads++
+		return os.ReadFile(fileName) /* #nosec G304 */
+	}
+	env := MockEnvironment{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REF_NAME":   "123/merge",
+		"GITHUB_EVENT_NAME": "pull_request",
+		"GITHUB_EVENT_PATH": "testdata/event-pull-request.json",
+	}
+	vs := VersionStringer{Git: &MockGitter{}, Env: env}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("123", vi.PullRequest)
+	is.Equal(1, reads) // read once for the default branch, branch text and pull request
+
+	env["GITHUB_EVENT_PATH"] = "testdata/event-push.json"
+	is.True(vs.IsReleaseBranch("trunk"))
+	is.True(!vs.IsReleaseBranch("main"))
+	is.Equal(2, reads) // read again for a new file
+
+	delete(env, "GITHUB_EVENT_PATH")
+	is.Equal(vs.GetGitHubEvent(), nil)
+	is.Equal(2, reads)
+}
+
+func Test_VersionStringer_IsReleaseBranch_GitHubEvent(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_EVENT_PATH": "testdata/event-push.json",
+	}
+	vs := VersionStringer{Env: env}
+
+	is.True(vs.IsReleaseBranch("trunk"))
+	is.True(!vs.IsReleaseBranch("main"))
+	is.True(!vs.IsReleaseBranch("master"))
+
+	env["GITHUB_REF_PROTECTED"] = "true"
+	is.True(vs.IsReleaseBranch("main"))
+}
+
+func Test_VersionStringer_GetBranch_GitHubPullRequest(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REF_NAME":   "123/merge",
+		"GITHUB_EVENT_PATH": "testdata/event-pull-request.json",
+	}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env}
+
+	text, name := vs.GetBranch(".")
+	is.Equal("pr-123", text)
+	is.Equal("123/merge", name)
+
+	env["GITHUB_EVENT_PATH"] = "testdata/event-push.json"
+	text, _ = vs.GetBranch(".")
+	is.Equal("123-merge", text)
+}
+
+func Test_VersionStringer_IsReleaseBranch_GiteaForgejo(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{
+		"GITHUB_ACTIONS":    "true",
+		"GITEA_ACTIONS":     "true",
+		"GITHUB_EVENT_PATH": "testdata/event-push.json",
+	}
+	vs := VersionStringer{Env: env}
+
+	is.True(vs.IsReleaseBranch("trunk"))
+	is.True(!vs.IsReleaseBranch("main"))
+
+	env["FORGEJO_ACTIONS"] = "true"
+	is.True(vs.IsReleaseBranch("trunk"))
+	is.True(!vs.IsReleaseBranch("main"))
+
+	delete(env, "GITHUB_EVENT_PATH")
+	is.True(vs.IsReleaseBranch("main"))
+}
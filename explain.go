@@ -0,0 +1,125 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of ExplainStep.
+const (
+	ExplainCI      = "ci"      // the CI system detected
+	ExplainEnv     = "env"     // an environment variable consulted
+	ExplainTree    = "tree"    // the current tree hash
+	ExplainFetch   = "fetch"   // a fetch from the remote
+	ExplainTag     = "tag"     // a tag considered or chosen
+	ExplainBranch  = "branch"  // the branch found
+	ExplainBuild   = "build"   // the build counter found
+	ExplainRelease = "release" // a release branch decision
+	ExplainSuffix  = "suffix"  // how the version suffix was built
+	ExplainVersion = "version" // how the final version was made
+)
+
+// ExplainStep is a single decision made while computing a version.
+type ExplainStep struct {
+	Kind  string `json:"kind"`            // one of the Explain... constants
+	Name  string `json:"name,omitempty"`  // what was examined, e.g. an environment variable or tag
+	Value string `json:"value,omitempty"` // what was found
+	Note  string `json:"note,omitempty"`  // what was decided, and why
+}
+
+// Explanation records the decisions made by a VersionStringer,
+// in the order they were made. Identical steps are recorded once.
+type Explanation struct {
+	Steps []ExplainStep `json:"steps"`
+}
+
+// Add records a step, unless an identical step is already recorded.
+func (ex *Explanation) Add(kind, name, value, note string) {
+	step := ExplainStep{Kind: kind, Name: name, Value: value, Note: note}
+	for _, s := range ex.Steps {
+		if s == step {
+			return
+		}
+	}
+	ex.Steps = append(ex.Steps, step)
+}
+
+// Find returns the recorded steps of the given kind and name.
+// An empty name matches all steps of that kind.
+func (ex *Explanation) Find(kind, name string) (steps []ExplainStep) {
+	for _, s := range ex.Steps {
+		if s.Kind == kind && (name == "" || s.Name == name) {
+			steps = append(steps, s)
+		}
+	}
+	return
+}
+
+// String returns a step as a line of text.
+func (s ExplainStep) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.Kind)
+	sb.WriteString(":")
+	if s.Name != "" {
+		sb.WriteString(" ")
+		sb.WriteString(s.Name)
+	}
+	if s.Value != "" {
+		if s.Name != "" {
+			sb.WriteString(" =")
+		}
+		sb.WriteString(" ")
+		sb.WriteString(strconv.Quote(s.Value))
+	}
+	if s.Note != "" {
+		sb.WriteString(" (")
+		sb.WriteString(s.Note)
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// String returns the explanation as readable text, one step per line.
+func (ex *Explanation) String() string {
+	var sb strings.Builder
+	for _, s := range ex.Steps {
+		sb.WriteString(s.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// JSON returns the explanation as indented JSON.
+func (ex *Explanation) JSON() (string, error) {
+	b, err := json.MarshalIndent(ex, "", "  ")
+	return string(b) + "\n", err
+}
+
+// explain records a step if the VersionStringer has an Explanation.
+func (vs *VersionStringer) explain(kind, name, value, note string, args ...interface{}) {
+	if vs.Explain != nil {
+		if len(args) > 0 {
+			note = fmt.Sprintf(note, args...)
+		}
+		vs.Explain.Add(kind, name, value, note)
+	}
+}
+
+// lookupEnv reads an environment variable, recording it in the explanation.
+func (vs *VersionStringer) lookupEnv(envvar string) (val string, ok bool) {
+	if val, ok = vs.Env.LookupEnv(envvar); ok {
+		vs.explain(ExplainEnv, envvar, val, "")
+	} else {
+		vs.explain(ExplainEnv, envvar, "", "not set")
+	}
+	return
+}
+
+// getenv returns the trimmed value of an environment variable,
+// recording it in the explanation.
+func (vs *VersionStringer) getenv(envvar string) string {
+	val, _ := vs.lookupEnv(envvar)
+	return strings.TrimSpace(val)
+}
@@ -0,0 +1,65 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_Explanation_Add(t *testing.T) {
+	is := is.New(t)
+	ex := &Explanation{}
+	ex.Add(ExplainEnv, "FOO", "bar", "")
+	ex.Add(ExplainEnv, "FOO", "bar", "")
+	ex.Add(ExplainEnv, "BAZ", "", "not set")
+	is.Equal(2, len(ex.Steps))
+	is.Equal([]ExplainStep{{Kind: ExplainEnv, Name: "BAZ", Note: "not set"}}, ex.Find(ExplainEnv, "BAZ"))
+	is.Equal(2, len(ex.Find(ExplainEnv, "")))
+	is.Equal(0, len(ex.Find(ExplainTag, "")))
+	is.Equal("env: FOO = \"bar\"\nenv: BAZ (not set)\n", ex.String())
+	is.Equal(`ci: "github"`, ExplainStep{Kind: ExplainCI, Value: "github"}.String())
+
+	txt, err := ex.JSON()
+	is.NoErr(err)
+	var decoded Explanation
+	is.NoErr(json.Unmarshal([]byte(txt), &decoded))
+	is.Equal(ex.Steps, decoded.Steps)
+}
+
+func Test_VersionStringer_Explain(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "feature", "CI_DEFAULT_BRANCH": "main", "CI_PIPELINE_IID": "45"}
+	git := &MockGitter{treehash: "tree-4"}
+	vs := VersionStringer{Git: git, Env: env, Explain: &Explanation{}}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0-feature.45", vi.Version)
+
+	ex := vs.Explain
+	is.Equal([]ExplainStep{{Kind: ExplainCI, Value: "gitlab"}}, ex.Find(ExplainCI, ""))
+	is.Equal([]ExplainStep{{Kind: ExplainEnv, Name: "CI_PIPELINE_IID", Value: "45"}}, ex.Find(ExplainEnv, "CI_PIPELINE_IID"))
+	is.Equal([]ExplainStep{{Kind: ExplainEnv, Name: "CI_COMMIT_TAG", Note: "not set"}}, ex.Find(ExplainEnv, "CI_COMMIT_TAG"))
+	is.Equal("tree-4", ex.Find(ExplainTree, "current")[0].Value)
+	is.Equal("different tree", ex.Find(ExplainTag, "v6.0.0")[0].Note)
+	is.Equal("same tree as current", ex.Find(ExplainTag, "v4.0.0")[0].Note)
+	is.Equal(0, len(ex.Find(ExplainTag, "v2.0.0")))
+	is.Equal("given by CI_PIPELINE_IID", ex.Find(ExplainBuild, "")[0].Note)
+	is.Equal([]ExplainStep{{Kind: ExplainRelease, Name: "feature", Value: "false", Note: `the branch is not the default branch "main"`}}, ex.Find(ExplainRelease, ""))
+	is.Equal(`branch text "feature" and build "45"`, ex.Find(ExplainSuffix, "")[0].Note)
+	is.Equal("v4.0.0-feature.45", ex.Find(ExplainVersion, "")[0].Value)
+	is.True(strings.Contains(ex.String(), "release: feature = \"false\""))
+}
+
+func Test_VersionStringer_Explain_Fallback(t *testing.T) {
+	is := is.New(t)
+	vs := VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{"CI_COMMIT_TAG": "latest"}, Explain: &Explanation{},
+		Config: &Config{TagPattern: "v[0-9]*"}}
+
+	tag, _ := vs.GetTag("/")
+	is.Equal("v0.0.0", tag)
+	is.Equal(`given by CI_COMMIT_TAG, but doesn't match "v[0-9]*"`, vs.Explain.Find(ExplainTag, "latest")[0].Note)
+	is.Equal("no tag found, using fallback", vs.Explain.Find(ExplainTag, "v0.0.0")[0].Note)
+}
@@ -0,0 +1,73 @@
+package makeversion
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DeepenSteps are the number of commits FetchAuto deepens a shallow
+// clone by, in turn, before giving up and fetching the full history.
+var DeepenSteps = []int{50, 500}
+
+// FetchTags fetches the remote tags using the given options. Only the zero
+// FetchOptions are supported unless the Gitter is a Fetcher.
+func (vs *VersionStringer) FetchTags(repo string, opts FetchOptions) error {
+	return fetchTags(vs.Git, repo, opts)
+}
+
+// FetchAuto fetches the remote tags using the given options. If the repository is a shallow
+// clone, it is deepened until a version tag is reachable from HEAD. If the
+// build number comes from the commit count, the full history is fetched
+// instead, since the count is wrong in a shallow clone. A Depth in opts is
+// tried first, and Unshallow fetches the full history straight away.
+//
+// For a shallow clone, returns an error if no version tag is reachable
+// afterwards, rather than letting GetVersion silently fall back.
+func (vs *VersionStringer) FetchAuto(repo string, opts FetchOptions) (err error) {
+	if !isShallow(vs.Git, repo) {
+		vs.explain(ExplainFetch, "", "tags", "not a shallow clone")
+		return fetchTags(vs.Git, repo, opts)
+	}
+
+	// deepen incrementally only if the build number doesn't come from the commit count
+	var steps []int
+	if !opts.Unshallow {
+		if opts.Depth > 0 {
+			steps = append(steps, opts.Depth)
+		}
+		for _, envvar := range buildEnvVars {
+			if vs.getenv(envvar) != "" {
+				steps = append(steps, DeepenSteps...)
+				break
+			}
+		}
+	}
+	steps = append(steps, 0)
+
+	cfg := vs.GetConfig()
+	var tag string
+	for i, depth := range steps {
+		if i > 0 && !isShallow(vs.Git, repo) {
+			// an earlier step fetched all there is
+			vs.explain(ExplainFetch, "", "complete", "the full history has been fetched")
+			break
+		}
+		opts.Depth, opts.Unshallow = depth, depth == 0
+		if err = fetchTags(vs.Git, repo, opts); err != nil {
+			return
+		}
+		tag = closestTag(vs.Git, repo, "HEAD", cfg.TagPattern)
+		if depth > 0 {
+			vs.explain(ExplainFetch, "", strconv.Itoa(depth), "deepened shallow clone, found %q", tag)
+		} else {
+			vs.explain(ExplainFetch, "", "unshallow", "fetched full history, found %q", tag)
+		}
+		if tag != "" {
+			break
+		}
+	}
+	if tag == "" {
+		err = fmt.Errorf("no tag matching %q is reachable from HEAD after fetching the full history", cfg.TagPattern)
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package makeversion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// makeShallowClone returns a depth 1 clone of a repository with the
+// given commits and tags, pushed to a bare repository used as origin.
+func makeShallowClone(t *testing.T, commits int, tags map[int]string) string {
+	t.Helper()
+	repo := makeTestRepo(t, commits, tags)
+	remote := t.TempDir()
+	runGit(t, remote, "init", "-q", "--bare", "-b", "main")
+	runGit(t, repo, "push", "-q", "--tags", remote, "main")
+	clone := t.TempDir()
+	runGit(t, clone, "clone", "-q", "--depth", "1", "file://"+remote, ".")
+	return clone
+}
+
+func Test_VersionStringer_FetchAuto(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+
+	clone := makeShallowClone(t, 5, map[int]string{2: "av1.0.0"})
+	vs := &VersionStringer{Git: dg, Env: MockEnvironment{}, Explain: &Explanation{}}
+	is.True(isShallow(dg, clone))
+	is.Equal("", dg.GetClosestTag(clone, "HEAD"))
+	is.NoErr(vs.FetchAuto(clone, FetchOptions{}))
+	is.True(!isShallow(dg, clone))
+	is.Equal("v1.0.0", dg.GetClosestTag(clone, "HEAD"))
+	is.Equal("5", vs.GetBuild(clone))
+	is.Equal("unshallow", vs.Explain.Find(ExplainFetch, "")[0].Value)
+
+	// with a build number from CI, deepening is enough
+	clone = makeShallowClone(t, 5, map[int]string{2: "av1.0.0"})
+	vs = &VersionStringer{Git: dg, Env: MockEnvironment{"GITHUB_RUN_NUMBER": "17"}, Explain: &Explanation{}}
+	saved := DeepenSteps
+	defer func() { DeepenSteps = saved }()
+	DeepenSteps = []int{1, 2}
+	is.NoErr(vs.FetchAuto(clone, FetchOptions{}))
+	is.True(isShallow(dg, clone))
+	is.Equal("v1.0.0", dg.GetClosestTag(clone, "HEAD"))
+	steps := vs.Explain.Find(ExplainFetch, "")
+	is.Equal("2", steps[len(steps)-1].Value)
+
+	// no reachable tag fails instead of falling back
+	clone = makeShallowClone(t, 3, nil)
+	vs = &VersionStringer{Git: dg, Env: MockEnvironment{}}
+	err = vs.FetchAuto(clone, FetchOptions{})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no tag matching"))
+
+	// deepening to the first commit stops without unshallowing
+	clone = makeShallowClone(t, 3, nil)
+	vs = &VersionStringer{Git: dg, Env: MockEnvironment{"GITHUB_RUN_NUMBER": "17"}, Explain: &Explanation{}}
+	DeepenSteps = []int{5, 50}
+	err = vs.FetchAuto(clone, FetchOptions{})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "no tag matching"))
+	steps = vs.Explain.Find(ExplainFetch, "")
+	is.Equal(2, len(steps))
+	is.Equal("complete", steps[1].Value)
+
+	// a given depth is tried first
+	clone = makeShallowClone(t, 5, map[int]string{4: "v1.0.0"})
+	vs.Explain = &Explanation{}
+	is.NoErr(vs.FetchAuto(clone, FetchOptions{Depth: 1}))
+	steps = vs.Explain.Find(ExplainFetch, "")
+	is.Equal(1, len(steps))
+	is.Equal("1", steps[0].Value)
+
+	// a complete repository just fetches tags
+	repo := makeTestRepo(t, 1, nil)
+	vs.Explain = &Explanation{}
+	is.NoErr(vs.FetchAuto(repo, FetchOptions{}))
+	is.Equal("tags", vs.Explain.Find(ExplainFetch, "")[0].Value)
+}
@@ -0,0 +1,165 @@
+package makeversion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Version formats accepted by VersionInfo.Format.
+const (
+	FormatSemver     = "semver"      // the version as is, e.g. "v1.2.3-feature.45"
+	FormatNPM        = "npm"         // strict semver without "v", e.g. "1.2.3-feature.45"
+	FormatPEP440     = "pep440"      // Python packages, e.g. "1.2.3.dev45+feature"
+	FormatDebian     = "deb"         // Debian packages, e.g. "1.2.3~feature.45"
+	FormatRPM        = "rpm"         // RPM version and release, e.g. "1.2.3~feature.45-1"
+	FormatRPMVersion = "rpm-version" // RPM Version tag, e.g. "1.2.3~feature.45"
+	FormatRPMRelease = "rpm-release" // RPM Release tag, e.g. "1"
+	FormatWindows    = "windows"     // Windows file version, e.g. "1.2.3.45"
+	FormatGoVersion  = "versioninfo" // goversioninfo's versioninfo.json
+)
+
+// Formats are the version formats accepted by VersionInfo.Format.
+var Formats = []string{FormatSemver, FormatNPM, FormatPEP440, FormatDebian, FormatRPM, FormatRPMVersion, FormatRPMRelease, FormatWindows, FormatGoVersion, FormatOCITags}
+
+// pep440Phases maps prerelease identifiers to PEP 440 pre-release phases.
+var pep440Phases = map[string]string{
+	"alpha": "a", "a": "a",
+	"beta": "b", "b": "b",
+	"rc": "rc", "c": "rc", "pre": "rc", "preview": "rc",
+}
+
+// rePEP440Phase matches a prerelease identifier naming a PEP 440 pre-release
+// phase, optionally followed by it's number, e.g. "rc" or "rc1".
+var rePEP440Phase = regexp.MustCompile(`^(alpha|a|beta|b|rc|c|pre|preview)(\d*)$`)
+
+// Format returns the version in the given format. All formats except
+// FormatSemver require the version to be a semantic version. The Windows
+// formats clamp the build counter, see VersionInfo.WindowsVersion, and
+// FormatOCITags uses the zero OCITagOptions.
+func (vi *VersionInfo) Format(format string) (s string, err error) {
+	if format == FormatSemver {
+		return vi.Version, nil
+	}
+	var sv Semver
+	if sv, err = ParseSemver(vi.Version); err == nil {
+		switch format {
+		case FormatNPM:
+			s = sv.NPM()
+		case FormatPEP440:
+			s = sv.PEP440()
+		case FormatDebian:
+			s = sv.Debian()
+		case FormatRPM:
+			version, release := sv.RPM()
+			s = version + "-" + release
+		case FormatRPMVersion:
+			s, _ = sv.RPM()
+		case FormatRPMRelease:
+			_, s = sv.RPM()
+		case FormatWindows:
+			var wv WindowsVersion
+			if wv, _, err = vi.WindowsVersion(); err == nil {
+				s = wv.String()
+			}
+		case FormatGoVersion:
+			var gvi GoVersionInfo
+			if gvi, _, err = vi.GoVersionInfo(""); err == nil {
+				s, err = gvi.JSON()
+			}
+		case FormatOCITags:
+			var tags []string
+			if tags, err = vi.OCITags(OCITagOptions{}); err == nil {
+				s = strings.Join(tags, "\n")
+			}
+		default:
+			err = fmt.Errorf("unknown version format %q", format)
+		}
+	}
+	return
+}
+
+// identifiers splits the prerelease or build metadata into identifiers,
+// also splitting at dashes, and leaves out empty ones.
+func identifiers(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '-' })
+}
+
+func isNumeric(ident string) bool {
+	return ident != "" && strings.Trim(ident, "0123456789") == ""
+}
+
+// NPM returns the version as strict semver without a leading "v".
+func (sv Semver) NPM() string {
+	return strings.TrimPrefix(sv.String(), "v")
+}
+
+// PEP440 returns the version as a PEP 440 Python package version.
+// Prereleases starting with "alpha", "beta", "rc" or similar become
+// pre-releases, e.g. "1.2.3rc1" for "rc1" or "rc.1", and others become
+// developmental releases, e.g. "1.2.3.dev45". Unless it follows the phase,
+// the number is the last numeric identifier, and the remaining identifiers
+// and build metadata form the local version label, e.g. "1.2.3.dev45+feature".
+func (sv Semver) PEP440() string {
+	s := fmt.Sprintf("%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	var local []string
+	if sv.Pre != "" {
+		pre := strings.ToLower(sv.Pre)
+		phase, num := ".dev", ""
+		first, rest := pre, ""
+		if i := strings.IndexByte(pre, '.'); i >= 0 {
+			first, rest = pre[:i], pre[i+1:]
+		}
+		if m := rePEP440Phase.FindStringSubmatch(first); m != nil {
+			phase, num, pre = pep440Phases[m[1]], m[2], rest
+		}
+		idents := identifiers(pre)
+		if num == "" {
+			num = "0"
+			for i := len(idents) - 1; i >= 0; i-- {
+				if isNumeric(idents[i]) {
+					num = idents[i]
+					idents = append(idents[:i:i], idents[i+1:]...)
+					break
+				}
+			}
+		}
+		if num = strings.TrimLeft(num, "0"); num == "" {
+			num = "0"
+		}
+		s += phase + num
+		local = idents
+	}
+	local = append(local, identifiers(strings.ToLower(sv.Build))...)
+	if len(local) > 0 {
+		s += "+" + strings.Join(local, ".")
+	}
+	return s
+}
+
+// Debian returns the version as a Debian upstream version. The prerelease
+// follows a tilde, so that it sorts before the release, e.g. "1.2.3~feature.45",
+// and build metadata follows a plus, e.g. "1.2.3+dirty".
+func (sv Semver) Debian() string {
+	s := fmt.Sprintf("%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	if idents := identifiers(sv.Pre); len(idents) > 0 {
+		s += "~" + strings.Join(idents, ".")
+	}
+	if idents := identifiers(sv.Build); len(idents) > 0 {
+		s += "+" + strings.Join(idents, ".")
+	}
+	return s
+}
+
+// RPM returns the version as RPM Version and Release tags. The prerelease
+// follows a tilde in the Version, so that it sorts before the release, e.g.
+// "1.2.3~feature.45". The Release is "1", followed by the build metadata,
+// e.g. "1.dirty".
+func (sv Semver) RPM() (version, release string) {
+	version = fmt.Sprintf("%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	if idents := identifiers(sv.Pre); len(idents) > 0 {
+		version += "~" + strings.Join(idents, ".")
+	}
+	release = strings.Join(append([]string{"1"}, identifiers(sv.Build)...), ".")
+	return
+}
@@ -0,0 +1,216 @@
+package makeversion
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// rePEP440 matches canonical PEP 440 versions, from the specification's appendix.
+var rePEP440 = regexp.MustCompile(`^([1-9][0-9]*!)?(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))*((a|b|rc)(0|[1-9][0-9]*))?(\.post(0|[1-9][0-9]*))?(\.dev(0|[1-9][0-9]*))?(\+[a-z0-9]+(\.[a-z0-9]+)*)?$`)
+
+func Test_VersionInfo_Format(t *testing.T) {
+	is := is.New(t)
+	formats := []string{FormatSemver, FormatNPM, FormatPEP440, FormatDebian, FormatRPM, FormatRPMVersion, FormatRPMRelease}
+	for version, want := range map[string][]string{
+		"v1.2.3":                   {"v1.2.3", "1.2.3", "1.2.3", "1.2.3", "1.2.3-1", "1.2.3", "1"},
+		"v1.2.3-feature.45":        {"v1.2.3-feature.45", "1.2.3-feature.45", "1.2.3.dev45+feature", "1.2.3~feature.45", "1.2.3~feature.45-1", "1.2.3~feature.45", "1"},
+		"v1.2.3-my-Branch.45":      {"v1.2.3-my-Branch.45", "1.2.3-my-Branch.45", "1.2.3.dev45+my.branch", "1.2.3~my.Branch.45", "1.2.3~my.Branch.45-1", "1.2.3~my.Branch.45", "1"},
+		"v1.2.3-rc.7":              {"v1.2.3-rc.7", "1.2.3-rc.7", "1.2.3rc7", "1.2.3~rc.7", "1.2.3~rc.7-1", "1.2.3~rc.7", "1"},
+		"v1.2.3-beta":              {"v1.2.3-beta", "1.2.3-beta", "1.2.3b0", "1.2.3~beta", "1.2.3~beta-1", "1.2.3~beta", "1"},
+		"v1.1.0-rc1":               {"v1.1.0-rc1", "1.1.0-rc1", "1.1.0rc1", "1.1.0~rc1", "1.1.0~rc1-1", "1.1.0~rc1", "1"},
+		"v1.2.3-beta2.feature.45":  {"v1.2.3-beta2.feature.45", "1.2.3-beta2.feature.45", "1.2.3b2+feature.45", "1.2.3~beta2.feature.45", "1.2.3~beta2.feature.45-1", "1.2.3~beta2.feature.45", "1"},
+		"v1.2.3-Preview07":         {"v1.2.3-Preview07", "1.2.3-Preview07", "1.2.3rc7", "1.2.3~Preview07", "1.2.3~Preview07-1", "1.2.3~Preview07", "1"},
+		"v1.2.3-pr.12.45":          {"v1.2.3-pr.12.45", "1.2.3-pr.12.45", "1.2.3.dev45+pr.12", "1.2.3~pr.12.45", "1.2.3~pr.12.45-1", "1.2.3~pr.12.45", "1"},
+		"v1.2.3-feature.45+dirty":  {"v1.2.3-feature.45+dirty", "1.2.3-feature.45+dirty", "1.2.3.dev45+feature.dirty", "1.2.3~feature.45+dirty", "1.2.3~feature.45-1.dirty", "1.2.3~feature.45", "1.dirty"},
+		"v0.0.0-main":              {"v0.0.0-main", "0.0.0-main", "0.0.0.dev0+main", "0.0.0~main", "0.0.0~main-1", "0.0.0~main", "1"},
+		"v10.20.30-a--b.1+x-y.007": {"v10.20.30-a--b.1+x-y.007", "10.20.30-a--b.1+x-y.007", "10.20.30.dev1+a.b.x.y.007", "10.20.30~a.b.1+x.y.007", "10.20.30~a.b.1-1.x.y.007", "10.20.30~a.b.1", "1.x.y.007"},
+	} {
+		vi := VersionInfo{Version: version}
+		for i, format := range formats {
+			s, err := vi.Format(format)
+			is.NoErr(err)
+			is.Equal(s, want[i]) // version in format
+		}
+		s, _ := vi.Format(FormatPEP440)
+		is.True(rePEP440.MatchString(s))
+	}
+
+	vi := VersionInfo{Version: "v1.2.3"}
+	_, err := vi.Format("nosuchformat")
+	is.True(err != nil)
+
+	vi.Version = "v1.2"
+	s, err := vi.Format(FormatSemver)
+	is.NoErr(err)
+	is.Equal(s, "v1.2")
+	_, err = vi.Format(FormatDebian)
+	is.True(err != nil)
+}
+
+func Test_Semver_Debian_Ordering(t *testing.T) {
+	is := is.New(t)
+	dpkg, err := exec.LookPath("dpkg")
+	if err != nil {
+		t.Skip(err)
+	}
+	// each version sorts before the next
+	versions := []string{"v1.2.2", "v1.2.3-beta.1", "v1.2.3-feature.9", "v1.2.3-feature.10", "v1.2.3-rc.1", "v1.2.3", "v1.2.3+dirty", "v1.2.4-main.1", "v1.10.0"}
+	for i := 1; i < len(versions); i++ {
+		a, err := ParseSemver(versions[i-1])
+		is.NoErr(err)
+		b, err := ParseSemver(versions[i])
+		is.NoErr(err)
+		cmd := exec.Command(dpkg, "--compare-versions", a.Debian(), "lt", b.Debian()) /* #nosec G204 */
+		if err := cmd.Run(); err != nil {
+			t.Errorf("%s doesn't sort before %s: %v", a.Debian(), b.Debian(), err)
+		}
+	}
+}
+
+// rpmvercmp compares two RPM version or release strings like rpm does,
+// returning -1, 0 or 1. A tilde sorts before anything, even the end.
+func rpmvercmp(a, b string) int {
+	isAlnum := func(c byte) bool {
+		return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	segment := func(s string, digits bool) string {
+		i := 0
+		for i < len(s) && isAlnum(s[i]) && (s[i] >= '0' && s[i] <= '9') == digits {
+			i++
+		}
+		return s[:i]
+	}
+	for a != "" || b != "" {
+		for a != "" && !isAlnum(a[0]) && a[0] != '~' {
+			a = a[1:]
+		}
+		for b != "" && !isAlnum(b[0]) && b[0] != '~' {
+			b = b[1:]
+		}
+		if ta, tb := strings.HasPrefix(a, "~"), strings.HasPrefix(b, "~"); ta || tb {
+			if !ta {
+				return 1
+			}
+			if !tb {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+		digits := a[0] >= '0' && a[0] <= '9'
+		sa, sb := segment(a, digits), segment(b, digits)
+		if sb == "" {
+			if digits {
+				return 1
+			}
+			return -1
+		}
+		a, b = a[len(sa):], b[len(sb):]
+		if digits {
+			sa, sb = strings.TrimLeft(sa, "0"), strings.TrimLeft(sb, "0")
+			if len(sa) > len(sb) {
+				return 1
+			}
+			if len(sa) < len(sb) {
+				return -1
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	}
+	return 1
+}
+
+func Test_rpmvercmp(t *testing.T) {
+	is := is.New(t)
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0}, {"1.0", "2.0", -1}, {"2.0.1", "2.0", 1}, {"1.01", "1.1", 0},
+		{"2.0a", "2.0", 1}, {"2a", "2.0", -1}, {"1.0~rc1", "1.0", -1}, {"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1}, {"1.0a", "1.0.1", -1}, {"10", "9", 1},
+	} {
+		is.Equal(tc.want, rpmvercmp(tc.a, tc.b))  // rpmvercmp(a, b)
+		is.Equal(-tc.want, rpmvercmp(tc.b, tc.a)) // rpmvercmp(b, a)
+	}
+}
+
+func Test_Semver_RPM_Ordering(t *testing.T) {
+	// each version sorts before the next
+	versions := []string{"v1.2.2", "v1.2.3-beta.1", "v1.2.3-feature.9", "v1.2.3-feature.10", "v1.2.3-rc.1", "v1.2.3-rc2", "v1.2.3", "v1.2.3+dirty", "v1.2.4-main.1", "v1.10.0"}
+	for i := 1; i < len(versions); i++ {
+		a, _ := ParseSemver(versions[i-1])
+		b, _ := ParseSemver(versions[i])
+		av, ar := a.RPM()
+		bv, br := b.RPM()
+		c := rpmvercmp(av, bv)
+		if c == 0 {
+			c = rpmvercmp(ar, br)
+		}
+		if c >= 0 {
+			t.Errorf("%s-%s doesn't sort before %s-%s", av, ar, bv, br)
+		}
+	}
+}
+
+// rePEP440Parts splits the PEP 440 versions made by Semver.PEP440.
+var rePEP440Parts = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:(a|b|rc)(\d+))?(?:\.dev(\d+))?(?:\+(.*))?$`)
+
+// pep440Less returns true if PEP 440 version a sorts before b. It only
+// handles the versions made by Semver.PEP440, which have either a
+// pre-release or a developmental release, and compares local version
+// labels as strings.
+func pep440Less(t *testing.T, a, b string) bool {
+	key := func(s string) (nums []int, local string) {
+		m := rePEP440Parts.FindStringSubmatch(s)
+		if m == nil {
+			t.Fatalf("can't parse %q", s)
+		}
+		num := func(s string) int {
+			n, _ := strconv.Atoi(s)
+			return n
+		}
+		// developmental releases sort before pre-releases, which sort before the release
+		phase := map[string]int{"a": 1, "b": 2, "rc": 3, "": 4}[m[4]]
+		if m[6] != "" {
+			phase = 0
+		}
+		return []int{num(m[1]), num(m[2]), num(m[3]), phase, num(m[5]), num(m[6])}, m[7]
+	}
+	an, al := key(a)
+	bn, bl := key(b)
+	for i := range an {
+		if an[i] != bn[i] {
+			return an[i] < bn[i]
+		}
+	}
+	return al < bl
+}
+
+func Test_Semver_PEP440_Ordering(t *testing.T) {
+	// each version sorts before the next
+	versions := []string{"v1.2.2", "v1.2.3-feature.9", "v1.2.3-feature.10", "v1.2.3-alpha", "v1.2.3-alpha.1", "v1.2.3-beta.1", "v1.2.3-beta2", "v1.2.3-rc1", "v1.2.3-rc.2", "v1.2.3", "v1.2.3+dirty", "v1.2.4-main.1", "v1.10.0"}
+	for i := 1; i < len(versions); i++ {
+		a, _ := ParseSemver(versions[i-1])
+		b, _ := ParseSemver(versions[i])
+		if !pep440Less(t, a.PEP440(), b.PEP440()) {
+			t.Errorf("%s doesn't sort before %s", a.PEP440(), b.PEP440())
+		}
+	}
+}
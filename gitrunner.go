@@ -0,0 +1,167 @@
+package makeversion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitEnv is added to the environment of every git command, so git
+// never waits for credentials on the terminal and it's output is stable.
+var gitEnv = []string{"GIT_TERMINAL_PROMPT=0", "LC_ALL=C"}
+
+// GitRun describes a finished git command.
+type GitRun struct {
+	Args     []string      // arguments given to git
+	Duration time.Duration // how long it ran
+	Err      error         // nil if it succeeded
+}
+
+func (gr GitRun) String() string {
+	s := fmt.Sprintf("git %s (%v)", strings.Join(gr.Args, " "), gr.Duration.Round(time.Microsecond))
+	if ge, ok := gr.Err.(*GitError); ok {
+		s += ": " + ge.reason()
+	} else if gr.Err != nil {
+		s += ": " + gr.Err.Error()
+	}
+	return s
+}
+
+// GitError is returned when a git command fails.
+type GitError struct {
+	Args   []string // arguments given to git
+	Stderr string   // what git wrote to stderr
+	Err    error    // why it failed, e.g. an *exec.ExitError or context.DeadlineExceeded
+}
+
+func (ge *GitError) Error() string {
+	return fmt.Sprintf("git %s: %s", strings.Join(ge.Args, " "), ge.reason())
+}
+
+// reason returns git's error message, or why git couldn't run.
+func (ge *GitError) reason() string {
+	if ge.Stderr != "" {
+		return ge.Stderr
+	}
+	return ge.Err.Error()
+}
+
+func (ge *GitError) Unwrap() error {
+	return ge.Err
+}
+
+// DubiousOwnershipError is returned when git refuses to work in a repository
+// owned by another user, which is common when building in containers.
+type DubiousOwnershipError struct {
+	Repo string // the repository git refused
+	Err  error  // the *GitError reporting it
+}
+
+func (de *DubiousOwnershipError) Error() string {
+	return fmt.Sprintf("git refuses to work in %q because it is owned by another user; "+
+		"run 'git config --global --add safe.directory %s', or use -trust-repo", de.Repo, de.Repo)
+}
+
+func (de *DubiousOwnershipError) Unwrap() error {
+	return de.Err
+}
+
+// isDubiousOwnership returns true if git's error message says the
+// repository has dubious ownership.
+func isDubiousOwnership(stderr string) bool {
+	return strings.Contains(stderr, "dubious ownership")
+}
+
+// errorSink stores the first error it is given.
+type errorSink struct {
+	mu  sync.Mutex
+	err *error
+}
+
+func (es *errorSink) set(err error) {
+	if es != nil {
+		es.mu.Lock()
+		defer es.mu.Unlock()
+		if *es.err == nil {
+			*es.err = err
+		}
+	}
+}
+
+// RecordErrors returns a copy of the GitRunner that stores the first
+// error that isn't git reporting failure in *err, such as a timeout, a missing
+// executable or a *DubiousOwnershipError. Methods that can't return errors get
+// empty results when that happens.
+func (gr *GitRunner) RecordErrors(err *error) Gitter {
+	return gr.withErrors(err)
+}
+
+func (gr *GitRunner) withErrors(err *error) *GitRunner {
+	gr.checkedRepos() // so the copy shares it
+	c := *gr
+	c.errs = &errorSink{err: err}
+	return &c
+}
+
+func (gr *GitRunner) context() context.Context {
+	if gr.Context != nil {
+		return gr.Context
+	}
+	return context.Background()
+}
+
+// command returns the command that runs git with the given arguments in the repository.
+func (gr *GitRunner) command(ctx context.Context, repo string, args ...string) *exec.Cmd {
+	cmdArgs := []string{"-C", repo}
+	if gr.TrustRepo {
+		if abs, err := filepath.Abs(repo); err == nil {
+			cmdArgs = append([]string{"-c", "safe.directory=" + abs}, cmdArgs...)
+		}
+	}
+	cmd := exec.CommandContext(ctx, gr.Bin, append(cmdArgs, args...)...) /* #nosec G204 */
+	cmd.Env = append(os.Environ(), gitEnv...)
+	return cmd
+}
+
+// run runs git with the given arguments in the repository, and returns what it wrote to stdout.
+func (gr *GitRunner) run(repo string, args ...string) ([]byte, error) {
+	return gr.runContext(gr.context(), repo, args...)
+}
+
+// runContext runs git with the given arguments in the repository, and returns
+// what it wrote to stdout. If git fails, the error is a *GitError.
+func (gr *GitRunner) runContext(ctx context.Context, repo string, args ...string) (stdout []byte, err error) {
+	if gr.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gr.Timeout)
+		defer cancel()
+	}
+	var stderr bytes.Buffer
+	cmd := gr.command(ctx, repo, args...)
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if stdout, err = cmd.Output(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		_, exited := err.(*exec.ExitError)
+		err = &GitError{Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		if isDubiousOwnership(stderr.String()) {
+			exited = false
+			err = &DubiousOwnershipError{Repo: repo, Err: err}
+		}
+		if !exited {
+			gr.errs.set(err)
+		}
+	}
+	if gr.OnRun != nil {
+		gr.OnRun(GitRun{Args: args, Duration: time.Since(start), Err: err})
+	}
+	return
+}
@@ -0,0 +1,147 @@
+package makeversion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// makeFakeGit writes a shell script that stands in for git. It prints
+// GIT_TERMINAL_PROMPT and LC_ALL, sleeps if asked to, and fails if asked to.
+// It reports dubious ownership for "rev-parse" unless the repo is trusted.
+func makeFakeGit(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	fileName := filepath.Join(t.TempDir(), "git")
+	script := `#!/bin/sh
+trusted=
+if [ "$1" = "-c" ]; then trusted="$2"; shift 2; fi
+case "$3" in
+sleep) exec sleep 5 ;;
+fail) echo "fatal: asked to fail" >&2; exit 128 ;;
+rev-parse|dubious)
+	if [ "$trusted" != "safe.directory=$2" ]; then
+		echo "fatal: detected dubious ownership in repository at '$2'" >&2
+		exit 128
+	fi ;;
+esac
+echo "$GIT_TERMINAL_PROMPT $LC_ALL"
+`
+	if err := os.WriteFile(fileName, []byte(script), 0700); err != nil /* #nosec G306 */ {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func Test_GitRunner_run(t *testing.T) {
+	is := is.New(t)
+	var runs []GitRun
+	var gitErr error
+	dg := (&GitRunner{Bin: makeFakeGit(t), OnRun: func(gr GitRun) { runs = append(runs, gr) }}).withErrors(&gitErr)
+
+	b, err := dg.run(".", "env")
+	is.NoErr(err)
+	is.Equal("0 C\n", string(b))
+	is.Equal(1, len(runs))
+	is.Equal([]string{"env"}, runs[0].Args)
+	is.True(runs[0].Duration > 0)
+
+	_, err = dg.run(".", "fail")
+	var ge *GitError
+	is.True(errors.As(err, &ge))
+	is.Equal("fatal: asked to fail", ge.Stderr)
+	is.Equal("git fail: fatal: asked to fail", err.Error())
+	is.Equal(runs[1].Err, err)
+	is.NoErr(gitErr) // git reporting failure isn't recorded
+
+	dg.Timeout = 50 * time.Millisecond
+	_, err = dg.run(".", "sleep")
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.Equal(err, gitErr)
+	is.True(strings.HasSuffix(runs[2].String(), ": context deadline exceeded"))
+}
+
+func Test_GitRunner_Context(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	dg := &GitRunner{Bin: makeFakeGit(t), Context: ctx}
+	cancel()
+	_, err := dg.run(".", "sleep")
+	is.True(errors.Is(err, context.Canceled))
+}
+
+func Test_GitRunner_DubiousOwnership(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 1, nil)
+	dg := &GitRunner{Bin: makeFakeGit(t)}
+
+	_, err := dg.run(repo, "dubious")
+	var de *DubiousOwnershipError
+	is.True(errors.As(err, &de))
+	is.Equal(repo, de.Repo)
+	is.True(strings.Contains(err.Error(), "safe.directory "+repo))
+	is.True(strings.Contains(err.Error(), "-trust-repo"))
+
+	dg = &GitRunner{Bin: dg.Bin}
+	_, err = dg.CheckGitRepo(repo)
+	is.True(errors.As(err, &de))
+	vs := &VersionStringer{Git: dg, Env: MockEnvironment{}}
+	_, err = vs.GetVersion(repo)
+	is.True(errors.As(err, &de))
+
+	dg = &GitRunner{Bin: dg.Bin, TrustRepo: true}
+	_, err = dg.CheckGitRepo(repo)
+	is.NoErr(err)
+	_, err = dg.run(repo, "dubious")
+	is.NoErr(err)
+}
+
+func Test_GitRunner_CheckGitRepo_Once(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 1, nil)
+	var runs []GitRun
+	dg := &GitRunner{Bin: makeFakeGit(t), TrustRepo: true, OnRun: func(gr GitRun) { runs = append(runs, gr) }}
+	var gitErr error
+	for _, git := range []Gitter{dg, dg, dg.RecordErrors(&gitErr)} {
+		_, err := git.CheckGitRepo(repo)
+		is.NoErr(err)
+	}
+	is.Equal(1, len(runs))
+	is.NoErr(gitErr)
+
+	// failures aren't remembered
+	dg = &GitRunner{Bin: dg.Bin, OnRun: dg.OnRun}
+	for i := 0; i < 2; i++ {
+		_, err := dg.CheckGitRepo(repo)
+		var de *DubiousOwnershipError
+		is.True(errors.As(err, &de))
+	}
+	is.Equal(3, len(runs))
+}
+
+func Test_VersionStringer_GetVersion_GitErrors(t *testing.T) {
+	is := is.New(t)
+	repo := makeTestRepo(t, 2, map[int]string{1: "v1.0.0"})
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	vs := &VersionStringer{Git: dg, Env: MockEnvironment{}}
+
+	dg.(*GitRunner).Timeout = time.Nanosecond
+	_, err = vs.GetVersion(repo)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+
+	// the error doesn't stick to the DefaultGitter
+	dg.(*GitRunner).Timeout = 0
+	vi, err := vs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2", vi.Version)
+}
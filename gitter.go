@@ -1,6 +1,8 @@
 package makeversion
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -9,6 +11,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Gitter is an interface exposing the required Git functionality
@@ -35,11 +39,250 @@ type Gitter interface {
 	FetchTags(repo string) error
 }
 
-type DefaultGitter string
+// The interfaces below are optional Git functionality. VersionStringer uses
+// them if the Gitter implements them, and does without them otherwise.
+
+// TagMatcher is implemented by Gitters that can find the closest
+// tag matching a glob pattern, for configured tag patterns.
+type TagMatcher interface {
+	// GetClosestTagMatch returns the closest tag matching the glob pattern for the given commit hash (or HEAD).
+	// An empty pattern means DefaultTagPattern.
+	GetClosestTagMatch(repo, commit, match string) (tag string)
+}
+
+// DirtyChecker is implemented by Gitters that can tell if the
+// working tree has uncommitted changes.
+type DirtyChecker interface {
+	// IsDirty returns true if tracked files in the working tree or the index differ from HEAD.
+	IsDirty(repo string) bool
+}
+
+// Fetcher is implemented by Gitters that can fetch with options.
+type Fetcher interface {
+	// FetchTagsWithOptions calls "git fetch --tags" with the given options.
+	FetchTagsWithOptions(repo string, opts FetchOptions) error
+}
+
+// ShallowChecker is implemented by Gitters that can tell if a repository is a shallow clone.
+type ShallowChecker interface {
+	// IsShallow returns true if the repository is a shallow clone.
+	IsShallow(repo string) bool
+}
+
+// CommitResolver is implemented by Gitters that can resolve names to commit hashes.
+type CommitResolver interface {
+	// GetCommit returns the commit hash for the given tag, branch or commit, or an empty string.
+	GetCommit(repo, rev string) string
+}
+
+// AccessChecker is implemented by Gitters that can check that git works in a repository.
+type AccessChecker interface {
+	// CheckAccess runs a trivial git command in the repository, returning git's error if it fails.
+	CheckAccess(repo string) error
+}
+
+// TagTyper is implemented by Gitters that can tell annotated and lightweight tags apart.
+type TagTyper interface {
+	// GetTagType returns "tag" for an annotated tag, "commit" for a lightweight tag, or an empty string.
+	GetTagType(repo, tag string) string
+}
+
+// RemoteTagLister is implemented by Gitters that can list the tags in a remote repository.
+type RemoteTagLister interface {
+	// GetRemoteTags returns the tags in the given remote repository.
+	GetRemoteTags(repo, remote string) (tags []string, err error)
+}
+
+// ErrorRecorder is implemented by Gitters whose methods can fail in ways
+// they can't return, like git timing out.
+type ErrorRecorder interface {
+	// RecordErrors returns a Gitter that works like this one, and stores
+	// the first such error in *err.
+	RecordErrors(err *error) Gitter
+}
+
+// recordErrors returns a Gitter that stores the first error git can't
+// return in *err, or git if it isn't an ErrorRecorder.
+func recordErrors(git Gitter, err *error) Gitter {
+	if er, ok := git.(ErrorRecorder); ok {
+		return er.RecordErrors(err)
+	}
+	return git
+}
+
+// closestTag returns the closest tag matching the glob pattern for the given commit
+// hash. If git isn't a TagMatcher, the tag returned by GetClosestTag is used if it matches.
+func closestTag(git Gitter, repo, commit, match string) (tag string) {
+	if tm, ok := git.(TagMatcher); ok {
+		return tm.GetClosestTagMatch(repo, commit, match)
+	}
+	if match == "" {
+		match = DefaultTagPattern
+	}
+	if tag = git.GetClosestTag(repo, commit); tag != "" {
+		if ok, _ := path.Match(match, tag); !ok {
+			tag = ""
+		}
+	}
+	return
+}
+
+// isDirty returns true if the working tree has uncommitted changes. If git
+// isn't a DirtyChecker, only changes in the index are seen, by comparing
+// the current tree hash with the tree hash of HEAD.
+func isDirty(git Gitter, repo string) bool {
+	if dc, ok := git.(DirtyChecker); ok {
+		return dc.IsDirty(repo)
+	}
+	if currtreehash := git.GetCurrentTreeHash(repo); currtreehash != "" {
+		return currtreehash != git.GetTreeHash(repo, "HEAD")
+	}
+	return false
+}
+
+// fetchTags fetches the tags with the given options. If git isn't a
+// Fetcher, only the zero FetchOptions are supported.
+func fetchTags(git Gitter, repo string, opts FetchOptions) error {
+	if f, ok := git.(Fetcher); ok {
+		return f.FetchTagsWithOptions(repo, opts)
+	}
+	if opts != (FetchOptions{}) {
+		return fmt.Errorf("%T can't fetch with options", git)
+	}
+	return git.FetchTags(repo)
+}
+
+// isShallow returns true if git is a ShallowChecker and the repository is a shallow clone.
+func isShallow(git Gitter, repo string) bool {
+	if sc, ok := git.(ShallowChecker); ok {
+		return sc.IsShallow(repo)
+	}
+	return false
+}
 
+// getCommit returns the commit hash for the given tag, branch or commit,
+// or an empty string if it can't be found or git isn't a CommitResolver.
+func getCommit(git Gitter, repo, rev string) string {
+	if cr, ok := git.(CommitResolver); ok {
+		return cr.GetCommit(repo, rev)
+	}
+	return ""
+}
+
+// checkAccess returns git's error if git is an AccessChecker and fails in the repository.
+func checkAccess(git Gitter, repo string) error {
+	if ac, ok := git.(AccessChecker); ok {
+		return ac.CheckAccess(repo)
+	}
+	return nil
+}
+
+// getTagType returns the type of the tag, or an empty string if it
+// can't be found or git isn't a TagTyper.
+func getTagType(git Gitter, repo, tag string) string {
+	if tt, ok := git.(TagTyper); ok {
+		return tt.GetTagType(repo, tag)
+	}
+	return ""
+}
+
+// getRemoteTags returns the tags in the remote repository, or an
+// error if git isn't a RemoteTagLister.
+func getRemoteTags(git Gitter, repo, remote string) ([]string, error) {
+	if rl, ok := git.(RemoteTagLister); ok {
+		return rl.GetRemoteTags(repo, remote)
+	}
+	return nil, fmt.Errorf("%T can't list remote tags", git)
+}
+
+// FetchOptions controls how FetchTagsWithOptions fetches from the remote.
+// The zero value fetches all tags from the default remote.
+type FetchOptions struct {
+	Remote    string        // remote name or URL, defaults to "origin" if Refspec is given
+	Refspec   string        // explicit refspec used instead of all tags, e.g. "+refs/tags/v*:refs/tags/v*"
+	PruneTags bool          // remove local tags that no longer exist in the remote
+	Depth     int           // if greater than zero, deepen a shallow clone by this many commits
+	Unshallow bool          // convert a shallow clone to a complete repository
+	Timeout   time.Duration // if greater than zero, give up after this long
+}
+
+// args returns the "git fetch" arguments for the options.
+func (opts FetchOptions) args() (args []string) {
+	args = []string{"fetch", "-q"}
+	if opts.Refspec == "" {
+		args = append(args, "--tags")
+	}
+	if opts.PruneTags {
+		args = append(args, "--prune", "--prune-tags")
+	}
+	if opts.Depth > 0 {
+		args = append(args, "--deepen="+strconv.Itoa(opts.Depth))
+	}
+	if opts.Unshallow {
+		args = append(args, "--unshallow")
+	}
+	remote := opts.Remote
+	if remote == "" && opts.Refspec != "" {
+		remote = "origin"
+	}
+	if remote != "" {
+		args = append(args, remote)
+		if opts.Refspec != "" {
+			args = append(args, opts.Refspec)
+		}
+	}
+	return
+}
+
+// GitRunner implements Gitter by running the git executable.
+// All git commands are run through a single runner, see run.
+type GitRunner struct {
+	Bin     string          // path of the git executable
+	Context context.Context // if not nil, cancelling it stops running git commands
+	Timeout time.Duration   // if greater than zero, git commands are stopped after this long
+	OnRun   func(GitRun)    // if not nil, called after each git command
+	// TrustRepo passes "-c safe.directory=<repo>" to git, so it works in
+	// repositories owned by other users. Only use it for trusted repositories.
+	TrustRepo bool
+	errs      *errorSink    // set by RecordErrors
+	checked   *checkedRepos // shared with the copies made by RecordErrors
+}
+
+// checkedRepos are the repositories CheckGitRepo found git works in.
+type checkedRepos struct {
+	mu    sync.Mutex
+	repos map[string]bool
+}
+
+// checkedMu guards setting GitRunner.checked.
+var checkedMu sync.Mutex
+
+// checkedRepos returns the repositories CheckGitRepo found git works in.
+func (gr *GitRunner) checkedRepos() *checkedRepos {
+	checkedMu.Lock()
+	defer checkedMu.Unlock()
+	if gr.checked == nil {
+		gr.checked = &checkedRepos{repos: make(map[string]bool)}
+	}
+	return gr.checked
+}
+
+func (cr *checkedRepos) has(repo string) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.repos[repo]
+}
+
+func (cr *checkedRepos) add(repo string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.repos[repo] = true
+}
+
+// NewDefaultGitter returns a *GitRunner for the git executable gitBin.
 func NewDefaultGitter(gitBin string) (gitter Gitter, err error) {
 	if gitBin, err = exec.LookPath(gitBin); err == nil {
-		gitter = DefaultGitter(gitBin)
+		gitter = &GitRunner{Bin: gitBin}
 	}
 	return
 }
@@ -72,12 +315,20 @@ func dirOrParentHasGitSubdir(dir string) string {
 // CheckGitRepo checks that the given directory is part of a git repository,
 // meaning that it or one of it's parent directories has a '.git' subdirectory.
 // If it is, it returns the absolute path of the git repo and a nil error.
-func (dg DefaultGitter) CheckGitRepo(dir string) (repo string, err error) {
+// If git refuses to work in it, the error is a *DubiousOwnershipError.
+// Git is only asked once per repository if it works there.
+func (gr *GitRunner) CheckGitRepo(dir string) (repo string, err error) {
 	if dir, err = filepath.Abs(dir); err == nil {
 		if err = checkDir(dir); err == nil {
 			if repo = dirOrParentHasGitSubdir(dir); repo == "" {
 				err = errors.New("can't find .git directory")
 				repo = dir
+			} else if checked := gr.checkedRepos(); !checked.has(repo) {
+				if _, e := gr.run(repo, "rev-parse", "--git-dir"); e == nil {
+					checked.add(repo)
+				} else if de, ok := e.(*DubiousOwnershipError); ok {
+					err = de
+				}
 			}
 		}
 	}
@@ -85,8 +336,8 @@ func (dg DefaultGitter) CheckGitRepo(dir string) (repo string, err error) {
 }
 
 // GetCommits returns all commit hashes.
-func (dg DefaultGitter) GetCommits(repo string) (commits []string) {
-	if b, _ := exec.Command(string(dg), "-C", repo, "rev-list", "--all").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetCommits(repo string) (commits []string) {
+	if b, _ := gr.run(repo, "rev-list", "--all"); len(b) > 0 {
 		for _, commit := range strings.Split(string(b), "\n") {
 			if commit = strings.TrimSpace(commit); len(commit) > 1 {
 				commits = append(commits, commit)
@@ -98,8 +349,8 @@ func (dg DefaultGitter) GetCommits(repo string) (commits []string) {
 
 // GetTags returns all tags, sorted by version descending.
 // The latest tag is the first in the list.
-func (dg DefaultGitter) GetTags(repo string) (tags []string) {
-	if b, _ := exec.Command(string(dg), "-C", repo, "tag", "--sort=-v:refname").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetTags(repo string) (tags []string) {
+	if b, _ := gr.run(repo, "tag", "--sort=-v:refname"); len(b) > 0 {
 		for _, tag := range strings.Split(string(b), "\n") {
 			if tag = strings.TrimSpace(tag); len(tag) > 1 {
 				tags = append(tags, tag)
@@ -110,29 +361,52 @@ func (dg DefaultGitter) GetTags(repo string) (tags []string) {
 }
 
 // GetCurrentTreeHash returns the current tree hash.
-func (dg DefaultGitter) GetCurrentTreeHash(repo string) string {
-	if b, _ := exec.Command(string(dg), "-C", repo, "write-tree").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetCurrentTreeHash(repo string) string {
+	if b, _ := gr.run(repo, "write-tree"); len(b) > 0 {
 		return strings.TrimSpace(string(b))
 	}
 	return ""
 }
 
 // GetTagTreeHash returns the tree hash for the given tag or commit hash.
-func (dg DefaultGitter) GetTreeHash(repo, tag string) string {
-	if b, _ := exec.Command(string(dg), "-C", repo, "rev-parse", tag+"^{tree}").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetTreeHash(repo, tag string) string {
+	if b, err := gr.run(repo, "rev-parse", tag+"^{tree}"); err == nil && len(b) > 0 {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
+// GetCommit returns the commit hash for the given tag, branch or commit, or an empty string.
+func (gr *GitRunner) GetCommit(repo, rev string) string {
+	if b, _ := gr.run(repo, "rev-parse", "--verify", "-q", rev+"^{commit}"); len(b) > 0 {
 		return strings.TrimSpace(string(b))
 	}
 	return ""
 }
 
 // GetClosestTag returns the closest semver tag for the given commit hash.
-func (dg DefaultGitter) GetClosestTag(repo, commit string) (tag string) {
-	if b, _ := exec.Command(string(dg), "-C", repo, "describe", "--tags", "--match=v[0-9]*", "--abbrev=0", commit).Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetClosestTag(repo, commit string) (tag string) {
+	return gr.GetClosestTagMatch(repo, commit, DefaultTagPattern)
+}
+
+// GetClosestTagMatch returns the closest tag matching the glob pattern for the given commit hash.
+// An empty pattern means DefaultTagPattern.
+func (gr *GitRunner) GetClosestTagMatch(repo, commit, match string) (tag string) {
+	if match == "" {
+		match = DefaultTagPattern
+	}
+	if b, _ := gr.run(repo, "describe", "--tags", "--match="+match, "--abbrev=0", commit); len(b) > 0 {
 		return strings.TrimSpace(string(b))
 	}
 	return ""
 }
 
+// IsDirty returns true if tracked files in the working tree or the index differ from HEAD.
+func (gr *GitRunner) IsDirty(repo string) bool {
+	b, err := gr.run(repo, "status", "--porcelain", "--untracked-files=no")
+	return err == nil && len(bytes.TrimSpace(b)) > 0
+}
+
 func lastName(s string) string {
 	if idx := strings.LastIndexByte(s, '/'); idx > -1 {
 		s = s[idx+1:]
@@ -140,10 +414,10 @@ func lastName(s string) string {
 	return s
 }
 
-func (dg DefaultGitter) GetBranchesFromTag(repo, tag string) (branches []string) {
+func (gr *GitRunner) GetBranchesFromTag(repo, tag string) (branches []string) {
 	tag = strings.TrimPrefix(tag, "refs/")
 	tag = strings.TrimPrefix(tag, "tags/")
-	if b, _ := exec.Command(string(dg), "-C", repo, "branch", "--all", "--no-color", "--contains", "tags/"+tag).Output(); len(b) > 0 /* #nosec G204 */ {
+	if b, _ := gr.run(repo, "branch", "--all", "--no-color", "--contains", "tags/"+tag); len(b) > 0 {
 		for _, s := range strings.Split(string(b), "\n") {
 			if s = strings.TrimSpace(s); len(s) > 1 {
 				if !strings.Contains(s, "HEAD") {
@@ -163,15 +437,15 @@ func (dg DefaultGitter) GetBranchesFromTag(repo, tag string) (branches []string)
 	return
 }
 
-func (dg DefaultGitter) GetBranch(repo string) (branch string) {
-	if b, _ := exec.Command(string(dg), "-C", repo, "branch", "--show-current").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetBranch(repo string) (branch string) {
+	if b, _ := gr.run(repo, "branch", "--show-current"); len(b) > 0 {
 		branch = strings.TrimSpace(string(b))
 	}
 	return
 }
 
-func (dg DefaultGitter) GetBuild(repo string) string {
-	if b, _ := exec.Command(string(dg), "-C", repo, "rev-list", "HEAD", "--count").Output(); len(b) > 0 /* #nosec G204 */ {
+func (gr *GitRunner) GetBuild(repo string) string {
+	if b, _ := gr.run(repo, "rev-list", "HEAD", "--count"); len(b) > 0 {
 		str := strings.TrimSpace(string(b))
 		if num, err := strconv.Atoi(str); err == nil && num > 0 {
 			return str
@@ -180,7 +454,150 @@ func (dg DefaultGitter) GetBuild(repo string) string {
 	return ""
 }
 
-func (dg DefaultGitter) FetchTags(repo string) (err error) {
-	err = exec.Command(string(dg), "-C", repo, "fetch", "--tags").Run() /* #nosec G204 */
+// FetchTags runs "git fetch --tags".
+// The error returned includes git's output.
+func (gr *GitRunner) FetchTags(repo string) error {
+	return gr.FetchTagsWithOptions(repo, FetchOptions{})
+}
+
+// FetchTagsWithOptions runs "git fetch --tags" with the given options.
+// The error returned includes git's output.
+func (gr *GitRunner) FetchTagsWithOptions(repo string, opts FetchOptions) (err error) {
+	ctx := gr.context()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	_, err = gr.runContext(ctx, repo, opts.args()...)
+	return
+}
+
+// CheckAccess runs "git rev-parse --git-dir" in the repository, returning
+// an error with git's output if it fails. This catches problems such as
+// git refusing to work in a repository with "dubious ownership".
+func (gr *GitRunner) CheckAccess(repo string) (err error) {
+	_, err = gr.run(repo, "rev-parse", "--git-dir")
+	return
+}
+
+// IsShallow returns true if the repository is a shallow clone.
+func (gr *GitRunner) IsShallow(repo string) bool {
+	if b, _ := gr.run(repo, "rev-parse", "--is-shallow-repository"); len(b) > 0 {
+		return strings.TrimSpace(string(b)) == "true"
+	}
+	_, err := os.Stat(path.Join(repo, ".git", "shallow"))
+	return err == nil
+}
+
+// GetTagType returns "tag" for an annotated tag, "commit" for a lightweight tag, or an empty string.
+func (gr *GitRunner) GetTagType(repo, tag string) string {
+	tag = strings.TrimPrefix(tag, "refs/")
+	tag = strings.TrimPrefix(tag, "tags/")
+	if b, _ := gr.run(repo, "cat-file", "-t", "refs/tags/"+tag); len(b) > 0 {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
+// GetRemoteTags returns the tags in the given remote repository, "origin" if empty.
+func (gr *GitRunner) GetRemoteTags(repo, remote string) (tags []string, err error) {
+	if remote == "" {
+		remote = "origin"
+	}
+	var b []byte
+	if b, err = gr.run(repo, "ls-remote", "--tags", "--refs", remote); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if idx := strings.Index(line, "refs/tags/"); idx > 0 {
+				tags = append(tags, strings.TrimSpace(line[idx+len("refs/tags/"):]))
+			}
+		}
+	}
 	return
 }
+
+// DefaultGitter implements Gitter by running the git executable at the path it holds.
+// Each call uses a GitRunner with default settings; use a GitRunner to set
+// a timeout, a context or to record errors.
+type DefaultGitter string
+
+func (dg DefaultGitter) runner() *GitRunner {
+	return &GitRunner{Bin: string(dg)}
+}
+
+func (dg DefaultGitter) CheckGitRepo(dir string) (string, error) {
+	return dg.runner().CheckGitRepo(dir)
+}
+
+func (dg DefaultGitter) GetCommits(repo string) []string {
+	return dg.runner().GetCommits(repo)
+}
+
+func (dg DefaultGitter) GetTags(repo string) []string {
+	return dg.runner().GetTags(repo)
+}
+
+func (dg DefaultGitter) GetCurrentTreeHash(repo string) string {
+	return dg.runner().GetCurrentTreeHash(repo)
+}
+
+func (dg DefaultGitter) GetTreeHash(repo, tag string) string {
+	return dg.runner().GetTreeHash(repo, tag)
+}
+
+func (dg DefaultGitter) GetCommit(repo, rev string) string {
+	return dg.runner().GetCommit(repo, rev)
+}
+
+func (dg DefaultGitter) GetClosestTag(repo, commit string) string {
+	return dg.runner().GetClosestTag(repo, commit)
+}
+
+func (dg DefaultGitter) GetClosestTagMatch(repo, commit, match string) string {
+	return dg.runner().GetClosestTagMatch(repo, commit, match)
+}
+
+func (dg DefaultGitter) IsDirty(repo string) bool {
+	return dg.runner().IsDirty(repo)
+}
+
+func (dg DefaultGitter) GetBranchesFromTag(repo, tag string) []string {
+	return dg.runner().GetBranchesFromTag(repo, tag)
+}
+
+func (dg DefaultGitter) GetBranch(repo string) string {
+	return dg.runner().GetBranch(repo)
+}
+
+func (dg DefaultGitter) GetBuild(repo string) string {
+	return dg.runner().GetBuild(repo)
+}
+
+func (dg DefaultGitter) FetchTags(repo string) error {
+	return dg.runner().FetchTags(repo)
+}
+
+func (dg DefaultGitter) FetchTagsWithOptions(repo string, opts FetchOptions) error {
+	return dg.runner().FetchTagsWithOptions(repo, opts)
+}
+
+func (dg DefaultGitter) CheckAccess(repo string) error {
+	return dg.runner().CheckAccess(repo)
+}
+
+func (dg DefaultGitter) IsShallow(repo string) bool {
+	return dg.runner().IsShallow(repo)
+}
+
+func (dg DefaultGitter) GetTagType(repo, tag string) string {
+	return dg.runner().GetTagType(repo, tag)
+}
+
+func (dg DefaultGitter) GetRemoteTags(repo, remote string) ([]string, error) {
+	return dg.runner().GetRemoteTags(repo, remote)
+}
+
+// RecordErrors returns a GitRunner for the git executable, see GitRunner.RecordErrors.
+func (dg DefaultGitter) RecordErrors(err *error) Gitter {
+	return dg.runner().RecordErrors(err)
+}
@@ -2,7 +2,10 @@ package makeversion
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
@@ -68,6 +71,20 @@ func Test_DefaultGitter_GetBranch(t *testing.T) {
 	is.Equal(dg.GetBranch("/"), "")
 }
 
+func Test_DefaultGitter_String(t *testing.T) {
+	is := is.New(t)
+	var git Gitter = DefaultGitter("git")
+	repo, err := git.CheckGitRepo(".")
+	is.NoErr(err)
+	is.True(git.GetBranch(repo) != "")
+	is.Equal(git.GetCurrentTreeHash(repo), (&GitRunner{Bin: "git"}).GetCurrentTreeHash(repo))
+	is.NoErr(checkAccess(git, repo))
+
+	var gitErr error
+	_, isRunner := recordErrors(git, &gitErr).(*GitRunner)
+	is.True(isRunner)
+}
+
 func Test_lastName(t *testing.T) {
 	is := is.New(t)
 	is.Equal("foo", lastName("foo"))
@@ -134,6 +151,66 @@ func Test_DefaultGitter_GetClosestTag(t *testing.T) {
 	}
 }
 
+func Test_closestTag(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{}
+	is.Equal("v4.0.0", closestTag(git, ".", "commit-5", "v4*"))
+
+	// a Gitter that isn't a TagMatcher only finds tags matching DefaultTagPattern
+	plain := struct{ Gitter }{git}
+	is.Equal("v4.0.0", closestTag(plain, ".", "commit-5", ""))
+	is.Equal("v4.0.0", closestTag(plain, ".", "commit-5", "v4*"))
+	is.Equal("", closestTag(plain, ".", "commit-5", "v2*"))
+}
+
+func Test_optionalGitter(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{shallow: true, remoteTags: []string{"v6.0.0"}}
+	is.True(isShallow(git, "."))
+	is.Equal("commit-4", getCommit(git, ".", "v4.0.0"))
+	is.Equal("commit", getTagType(git, ".", "v2.0.0"))
+	tags, err := getRemoteTags(git, ".", "")
+	is.NoErr(err)
+	is.Equal([]string{"v6.0.0"}, tags)
+
+	// a plain Gitter does without the optional functionality
+	plain := struct{ Gitter }{git}
+	is.NoErr(fetchTags(plain, ".", FetchOptions{}))
+	is.True(fetchTags(plain, ".", FetchOptions{Unshallow: true}) != nil)
+	is.True(!isShallow(plain, "."))
+	is.Equal("", getCommit(plain, ".", "v4.0.0"))
+	is.NoErr(checkAccess(plain, "."))
+	is.Equal("", getTagType(plain, ".", "v2.0.0"))
+	_, err = getRemoteTags(plain, ".", "")
+	is.True(err != nil)
+}
+
+func Test_DefaultGitter_IsDirty(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo := makeTestRepo(t, 2, map[int]string{1: "v1.0.0"})
+	vs := &VersionStringer{Git: dg, Env: MockEnvironment{}, Config: &Config{DirtyMarker: "dirty"}}
+	is.True(!vs.IsDirty(repo))
+
+	// untracked files don't count
+	is.NoErr(os.WriteFile(filepath.Join(repo, "untracked.txt"), []byte("x"), 0600))
+	is.True(!vs.IsDirty(repo))
+
+	// an edit to a tracked file that isn't staged does
+	is.NoErr(os.WriteFile(filepath.Join(repo, "file.txt"), []byte("edited"), 0600))
+	is.True(vs.IsDirty(repo))
+	vi, err := vs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.0.0-main.2+dirty", vi.Version)
+
+	runGit(t, repo, "add", "file.txt")
+	is.True(vs.IsDirty(repo))
+
+	runGit(t, repo, "commit", "-q", "-m", "edited")
+	is.True(!vs.IsDirty(repo))
+}
+
 func Test_DefaultGitter_GetBranchFromTag(t *testing.T) {
 	is := is.New(t)
 	dg, err := NewDefaultGitter("git")
@@ -159,3 +236,76 @@ func Test_DefaultGitter_FetchTags(t *testing.T) {
 	is.True(dg != nil)
 	dg.FetchTags(".")
 }
+
+func Test_DefaultGitter_CheckAccess(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	is.NoErr(checkAccess(dg, "."))
+	err = checkAccess(dg, t.TempDir())
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "not a git repository"))
+}
+
+func Test_DefaultGitter_TagTypesAndRemote(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo := makeTestRepo(t, 3, map[int]string{1: "v1.0.0", 2: "av2.0.0"})
+
+	is.True(!isShallow(dg, repo))
+	is.Equal("commit", getTagType(dg, repo, "v1.0.0"))
+	is.Equal("tag", getTagType(dg, repo, "refs/tags/v2.0.0"))
+	is.Equal("", getTagType(dg, repo, "v3.0.0"))
+
+	_, err = getRemoteTags(dg, repo, "")
+	is.True(err != nil)
+
+	remote := t.TempDir()
+	runGit(t, remote, "init", "-q", "--bare")
+	runGit(t, repo, "remote", "add", "origin", remote)
+	runGit(t, repo, "push", "-q", "origin", "main", "v1.0.0")
+	tags, err := getRemoteTags(dg, repo, "origin")
+	is.NoErr(err)
+	is.Equal([]string{"v1.0.0"}, tags)
+
+	clone := t.TempDir()
+	runGit(t, clone, "clone", "-q", "--depth", "1", "file://"+repo, ".")
+	is.True(isShallow(dg, clone))
+}
+
+func Test_FetchOptions_args(t *testing.T) {
+	is := is.New(t)
+	is.Equal([]string{"fetch", "-q", "--tags"}, FetchOptions{}.args())
+	is.Equal([]string{"fetch", "-q", "origin", "+refs/tags/v*:refs/tags/v*"},
+		FetchOptions{Refspec: "+refs/tags/v*:refs/tags/v*"}.args())
+	is.Equal([]string{"fetch", "-q", "--tags", "--prune", "--prune-tags", "--deepen=10", "upstream"},
+		FetchOptions{Remote: "upstream", PruneTags: true, Depth: 10}.args())
+	is.Equal([]string{"fetch", "-q", "--tags", "--unshallow"}, FetchOptions{Unshallow: true}.args())
+}
+
+func Test_DefaultGitter_FetchTags_Options(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+
+	remote := makeTestRepo(t, 3, map[int]string{1: "v1.0.0", 2: "av2.0.0", 3: "other"})
+	repo := t.TempDir()
+	runGit(t, repo, "init", "-q", "-b", "main")
+	runGit(t, repo, "remote", "add", "upstream", remote)
+
+	is.NoErr(fetchTags(dg, repo, FetchOptions{Remote: "upstream", Refspec: "+refs/tags/v*:refs/tags/v*"}))
+	is.Equal([]string{"v2.0.0", "v1.0.0"}, dg.GetTags(repo))
+
+	runGit(t, remote, "tag", "-d", "v2.0.0")
+	is.NoErr(fetchTags(dg, repo, FetchOptions{Remote: "upstream", PruneTags: true}))
+	is.Equal([]string{"v1.0.0", "other"}, dg.GetTags(repo))
+
+	err = fetchTags(dg, repo, FetchOptions{Remote: "nosuchremote"})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "nosuchremote"))
+
+	err = fetchTags(dg, repo, FetchOptions{Remote: "upstream", Timeout: time.Nanosecond})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "deadline exceeded"))
+}
@@ -0,0 +1,190 @@
+package makeversiontest
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/cparta/makeversion/v2"
+	"github.com/matryer/is"
+)
+
+// scenarios are the histories every Gitter must agree on.
+var scenarios = map[string]func() *Repo{
+	"linear": func() *Repo {
+		return NewRepo().Commit("a").Tag("v1.0.0").Commit("b").Commit("c").Tag("v1.1.0").Commit("d")
+	},
+	"tag on merge": func() *Repo {
+		return NewRepo().
+			Commit("a").AnnotatedTag("v1.0.0").
+			Branch("feature").Commit("b").Commit("c").
+			Checkout("main").Commit("d").
+			Merge("feature", "e").AnnotatedTag("v1.1.0").
+			Commit("f")
+	},
+	"tags on merged branch": func() *Repo {
+		return NewRepo().
+			Commit("a").Tag("v1.0.0").
+			Branch("feature").Commit("b").Tag("v1.0.1").
+			Checkout("main").Commit("c").
+			Merge("feature", "d")
+	},
+	"annotated and lightweight": func() *Repo {
+		return NewRepo().
+			Commit("a").Tag("v1.0.0").AnnotatedTag("v1.0.1").Tag("v1.0.2").
+			Commit("b").Tag("v2.0.1").Tag("v2.0.0").
+			Commit("c")
+	},
+	"same tree": func() *Repo {
+		return NewRepo().
+			Commit("a").AnnotatedTag("v1.0.0").
+			Commit("b").AnnotatedTag("v1.1.0").
+			CommitSameTree("c", "a")
+	},
+	"detached": func() *Repo {
+		return NewRepo().
+			Commit("a").Tag("v1.0.0").
+			Branch("release").Commit("b").AnnotatedTag("v1.1.0").
+			Checkout("main").Commit("c").
+			Detach("v1.1.0")
+	},
+	"orphan": func() *Repo {
+		return NewRepo().
+			Commit("a").Tag("v1.0.0").
+			Orphan("docs").Commit("x").Commit("y")
+	},
+	"dirty": func() *Repo {
+		return NewRepo().Commit("a").AnnotatedTag("v1.0.0").Dirty()
+	},
+	"untagged": func() *Repo {
+		return NewRepo().Commit("a").Commit("b")
+	},
+}
+
+// environments are used to compare GetVersion across Gitters.
+var environments = []Environment{
+	{},
+	{"GITHUB_ACTIONS": "true", "GITHUB_REF_NAME": "feature/x", "GITHUB_RUN_NUMBER": "42"},
+	{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "main", "CI_DEFAULT_BRANCH": "main"},
+}
+
+// implementation is a Gitter under test, with a function translating
+// the Repo names for commits and trees to and from it's hashes.
+type implementation struct {
+	git    makeversion.Gitter
+	repo   string
+	rev    func(name string) string // Repo name to revision
+	unhash func(hash string) string // hash to Repo name
+}
+
+// results calls each Gitter method that reads the repository, and returns
+// the results with hashes translated to Repo names.
+func results(r *Repo, impl implementation) map[string]interface{} {
+	g, repo := impl.git, impl.repo
+	res := make(map[string]interface{})
+	var commits []string
+	for _, hash := range g.GetCommits(repo) {
+		commits = append(commits, impl.unhash(hash))
+	}
+	res["GetCommits"] = commits
+	res["GetTags"] = g.GetTags(repo)
+	res["GetCurrentTreeHash"] = impl.unhash(g.GetCurrentTreeHash(repo))
+	res["GetBranch"] = g.GetBranch(repo)
+	res["GetBuild"] = g.GetBuild(repo)
+	res["IsShallow"] = g.(makeversion.ShallowChecker).IsShallow(repo)
+	res["GetClosestTag(HEAD)"] = g.GetClosestTag(repo, "HEAD")
+	res["IsDirty"] = g.(makeversion.DirtyChecker).IsDirty(repo)
+	for _, c := range r.commits {
+		rev := impl.rev(c.name)
+		res["GetTreeHash("+c.name+")"] = impl.unhash(g.GetTreeHash(repo, rev))
+		res["GetCommit("+c.name+")"] = impl.unhash(g.(makeversion.CommitResolver).GetCommit(repo, rev))
+		res["GetClosestTag("+c.name+")"] = g.GetClosestTag(repo, rev)
+		res["GetClosestTagMatch("+c.name+")"] = g.(makeversion.TagMatcher).GetClosestTagMatch(repo, rev, "v*")
+	}
+	for _, t := range r.tags {
+		res["GetTreeHash("+t.name+")"] = impl.unhash(g.GetTreeHash(repo, t.name))
+		res["GetCommit("+t.name+")"] = impl.unhash(g.(makeversion.CommitResolver).GetCommit(repo, t.name))
+		res["GetTagType("+t.name+")"] = g.(makeversion.TagTyper).GetTagType(repo, t.name)
+		res["GetBranchesFromTag("+t.name+")"] = g.GetBranchesFromTag(repo, t.name)
+	}
+	for i, env := range environments {
+		vi, err := (&makeversion.VersionStringer{Git: g, Env: env}).GetVersion(repo)
+		res[fmt.Sprintf("GetVersion(env %d)", i)] = fmt.Sprintf("%+v %v", vi, err)
+	}
+	return res
+}
+
+// implementations returns the Gitters to compare with the Repo, using
+// a real git repository created from it. Call the returned function
+// to release them.
+func implementations(t *testing.T, r *Repo) (impls map[string]implementation, done func()) {
+	t.Helper()
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	hashes, err := r.Materialize(gitBin, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string)
+	for name, hash := range hashes {
+		names[hash] = name
+	}
+	rev := func(name string) string { return hashes[name] }
+	unhash := func(hash string) string {
+		if name, ok := names[hash]; ok || hash == "" {
+			return name
+		}
+		return "unknown " + hash
+	}
+
+	dg := makeversion.DefaultGitter(gitBin)
+	bg, err := makeversion.NewBatchGitter(&makeversion.GitRunner{Bin: gitBin}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg := makeversion.NewRecordingGitter(&makeversion.GitRunner{Bin: gitBin})
+	impls = map[string]implementation{
+		"DefaultGitter":   {git: dg, repo: dir, rev: rev, unhash: unhash},
+		"BatchGitter":     {git: bg, repo: dir, rev: rev, unhash: unhash},
+		"RecordingGitter": {git: rg, repo: dir, rev: rev, unhash: unhash},
+	}
+	return impls, func() { _ = bg.Close() }
+}
+
+func Test_Differential(t *testing.T) {
+	for name, scenario := range scenarios {
+		scenario := scenario
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			r := scenario()
+			is.NoErr(r.Err())
+			identity := func(s string) string { return s }
+			want := results(r, implementation{git: r, repo: ".", rev: identity, unhash: identity})
+
+			impls, done := implementations(t, r)
+			defer done()
+			for implName, impl := range impls {
+				got := results(r, impl)
+				for key, val := range want {
+					if fmt.Sprint(got[key]) != fmt.Sprint(val) {
+						t.Errorf("%s: %s = %v, Repo has %v", implName, key, got[key], val)
+					}
+				}
+			}
+
+			// a replay of the recording must give the same results
+			rg := impls["RecordingGitter"].git.(*makeversion.RecordingGitter)
+			replay := impls["RecordingGitter"]
+			replay.git = makeversion.NewReplayGitter(rg.Fixture())
+			got := results(r, replay)
+			for key, val := range want {
+				if fmt.Sprint(got[key]) != fmt.Sprint(val) {
+					t.Errorf("ReplayGitter: %s = %v, Repo has %v", key, got[key], val)
+				}
+			}
+		})
+	}
+}
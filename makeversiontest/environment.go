@@ -0,0 +1,16 @@
+// Package makeversiontest provides fakes for testing code that uses makeversion:
+// an Environment, and a Repo that implements makeversion.Gitter for a scripted
+// history and can create the same history as a real git repository.
+package makeversiontest
+
+// Environment is a fake makeversion.Environment holding the variables set.
+type Environment map[string]string
+
+func (env Environment) Getenv(key string) string {
+	return env[key]
+}
+
+func (env Environment) LookupEnv(key string) (val string, ok bool) {
+	val, ok = env[key]
+	return
+}
@@ -0,0 +1,116 @@
+package makeversiontest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileName is the file in materialized repositories whose content is the tree key.
+const FileName = "tree.txt"
+
+// baseTime is the commit date of the first commit in materialized repositories.
+// Later commits and tags are one second apart, in creation order.
+const baseTime = 1600000000
+
+// Materialize creates the Repo as a real git repository in the directory, with the
+// same commits, branches, tags, checked out branch or detached HEAD and dirty state.
+// It returns a map from the commit names and tree hashes used by the Repo to the
+// hashes in the git repository.
+func (r *Repo) Materialize(gitBin, dir string) (hashes map[string]string, err error) {
+	if err = r.err; err != nil {
+		return
+	}
+	m := materializer{gitBin: gitBin, dir: dir}
+	hashes = make(map[string]string)
+	m.run(nil, "init", "-q")
+
+	trees := []string{}
+	for _, c := range r.commits {
+		trees = append(trees, c.tree)
+	}
+	if r.dirty {
+		trees = append(trees, DirtyTree)
+	}
+	for _, key := range trees {
+		if _, ok := hashes[TreeHash(key)]; !ok {
+			blob := m.run([]byte(key+"\n"), "hash-object", "-w", "--stdin")
+			hashes[TreeHash(key)] = m.run([]byte("100644 blob "+blob+"\t"+FileName+"\n"), "mktree")
+		}
+	}
+
+	for i, c := range r.commits {
+		args := []string{"commit-tree", hashes[TreeHash(c.tree)], "-m", c.name}
+		for _, p := range c.parents {
+			args = append(args, "-p", hashes[p])
+		}
+		m.date = baseTime + i
+		hashes[c.name] = m.run(nil, args...)
+	}
+	for name, tip := range r.branches {
+		if tip != "" {
+			m.run(nil, "update-ref", "refs/heads/"+name, hashes[tip])
+		}
+	}
+	for i, t := range r.tags {
+		m.date = baseTime + len(r.commits) + i
+		if t.annotated {
+			m.run(nil, "tag", "-a", "-m", t.name, t.name, hashes[t.commit])
+		} else {
+			m.run(nil, "tag", t.name, hashes[t.commit])
+		}
+	}
+
+	if r.branch != "" {
+		m.run(nil, "symbolic-ref", "HEAD", "refs/heads/"+r.branch)
+	} else {
+		m.run(nil, "update-ref", "--no-deref", "HEAD", hashes[r.head])
+	}
+	if r.headCommit() != "" {
+		m.run(nil, "reset", "-q", "--hard")
+	}
+	if r.dirty && m.err == nil {
+		if m.err = os.WriteFile(filepath.Join(dir, FileName), []byte(DirtyTree+"\n"), 0600); m.err == nil {
+			m.run(nil, "add", FileName)
+		}
+	}
+	if err = m.err; err != nil {
+		hashes = nil
+	}
+	return
+}
+
+// materializer runs git commands in a repository, stopping at the first error.
+type materializer struct {
+	gitBin string
+	dir    string
+	date   int // commit and tag date, seconds since the epoch
+	err    error
+}
+
+// run runs git with the given input and arguments and returns it's
+// trimmed output, unless an earlier command failed.
+func (m *materializer) run(stdin []byte, args ...string) string {
+	if m.err != nil {
+		return ""
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(m.gitBin, append([]string{"-C", m.dir}, args...)...) /* #nosec G204 */
+	date := strconv.Itoa(m.date) + " +0000"
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=makeversiontest", "GIT_AUTHOR_EMAIL=makeversiontest@example.com", "GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=makeversiontest", "GIT_COMMITTER_EMAIL=makeversiontest@example.com", "GIT_COMMITTER_DATE="+date,
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "HOME="+m.dir,
+	)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if m.err = cmd.Run(); m.err != nil {
+		m.err = fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), m.err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String())
+}
@@ -0,0 +1,510 @@
+package makeversiontest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cparta/makeversion/v2"
+)
+
+// DefaultBranch is the branch a new Repo has checked out.
+const DefaultBranch = "main"
+
+// DirtyTree is the tree key of the current tree when the Repo is dirty.
+const DirtyTree = "dirty"
+
+type commit struct {
+	name    string
+	parents []string
+	tree    string // tree key, see TreeHash
+}
+
+type tag struct {
+	name      string
+	commit    string
+	annotated bool
+}
+
+// Repo is a fake repository implementing makeversion.Gitter. It is built
+// by calling it's methods in turn, like running git commands:
+//
+//	repo := makeversiontest.NewRepo().
+//		Commit("a").Tag("v1.0.0").
+//		Branch("feature").Commit("b").
+//		Checkout("main").Merge("feature", "c")
+//
+// Commit hashes are the commit names, and tree hashes are made by TreeHash.
+// Mistakes such as using unknown names are reported by Err, which makes
+// VersionStringer.GetVersion fail. A Repo must not be changed while in use.
+type Repo struct {
+	commits  []*commit
+	byName   map[string]*commit
+	tags     []*tag            // in creation order
+	branches map[string]string // branch name to commit name, empty if it has no commits
+	branch   string            // checked out branch, empty if HEAD is detached
+	head     string            // commit at HEAD if detached
+	dirty    bool
+	err      error
+}
+
+var _ makeversion.Gitter = (*Repo)(nil)
+
+// NewRepo returns an empty Repo with DefaultBranch checked out.
+func NewRepo() *Repo {
+	return &Repo{
+		byName:   make(map[string]*commit),
+		branches: map[string]string{DefaultBranch: ""},
+		branch:   DefaultBranch,
+	}
+}
+
+// TreeHash returns the fake tree hash for the tree key. Commits made by
+// Commit and Merge have their name as tree key, and CommitSameTree uses
+// the key of another commit.
+func TreeHash(key string) string {
+	return "tree-" + key
+}
+
+// Err returns the first mistake made building the Repo, or nil.
+func (r *Repo) Err() error {
+	return r.err
+}
+
+// RecordErrors stores the first mistake made building the Repo in *err,
+// so GetVersion returns it, and returns the Repo.
+func (r *Repo) RecordErrors(err *error) makeversion.Gitter {
+	if *err == nil {
+		*err = r.err
+	}
+	return r
+}
+
+func (r *Repo) fail(format string, args ...interface{}) *Repo {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+	return r
+}
+
+// VersionStringer returns a VersionStringer using the Repo and the environment.
+func (r *Repo) VersionStringer(env Environment) *makeversion.VersionStringer {
+	return &makeversion.VersionStringer{Git: r, Env: env}
+}
+
+// headCommit returns the name of the commit at HEAD, or an empty string.
+func (r *Repo) headCommit() string {
+	if r.branch != "" {
+		return r.branches[r.branch]
+	}
+	return r.head
+}
+
+// setHead moves the checked out branch, or the detached HEAD, to the commit.
+func (r *Repo) setHead(name string) {
+	if r.branch != "" {
+		r.branches[r.branch] = name
+	} else {
+		r.head = name
+	}
+}
+
+func (r *Repo) addCommit(name, tree string, parents ...string) *Repo {
+	if name == "" || r.byName[name] != nil {
+		return r.fail("commit name %q is empty or already used", name)
+	}
+	c := &commit{name: name, tree: tree}
+	for _, p := range parents {
+		if p != "" {
+			c.parents = append(c.parents, p)
+		}
+	}
+	r.commits = append(r.commits, c)
+	r.byName[name] = c
+	r.setHead(name)
+	return r
+}
+
+// Commit adds a commit with a tree of it's own on top of HEAD.
+func (r *Repo) Commit(name string) *Repo {
+	return r.addCommit(name, name, r.headCommit())
+}
+
+// CommitSameTree adds a commit on top of HEAD, with the same tree as the other commit.
+func (r *Repo) CommitSameTree(name, other string) *Repo {
+	c := r.byName[other]
+	if c == nil {
+		return r.fail("CommitSameTree %q: unknown commit %q", name, other)
+	}
+	return r.addCommit(name, c.tree, r.headCommit())
+}
+
+// Merge adds a merge commit of HEAD and the tip of the branch, with a tree of it's own.
+func (r *Repo) Merge(branch, name string) *Repo {
+	tip, ok := r.branches[branch]
+	if !ok || tip == "" || r.headCommit() == "" {
+		return r.fail("Merge %q: can't merge branch %q", name, branch)
+	}
+	return r.addCommit(name, name, r.headCommit(), tip)
+}
+
+// Branch creates a branch at HEAD and checks it out.
+func (r *Repo) Branch(name string) *Repo {
+	if _, ok := r.branches[name]; ok || name == "" {
+		return r.fail("branch %q is empty or already exists", name)
+	}
+	r.branches[name] = r.headCommit()
+	r.branch = name
+	return r
+}
+
+// Orphan creates a branch without commits and checks it out.
+func (r *Repo) Orphan(name string) *Repo {
+	if _, ok := r.branches[name]; ok || name == "" {
+		return r.fail("branch %q is empty or already exists", name)
+	}
+	r.branches[name] = ""
+	r.branch = name
+	return r
+}
+
+// Checkout checks out the branch.
+func (r *Repo) Checkout(name string) *Repo {
+	if _, ok := r.branches[name]; !ok {
+		return r.fail("Checkout: unknown branch %q", name)
+	}
+	r.branch = name
+	return r
+}
+
+// Detach checks out the commit, tag or branch with a detached HEAD.
+func (r *Repo) Detach(rev string) *Repo {
+	name := r.resolve(rev)
+	if name == "" {
+		return r.fail("Detach: unknown revision %q", rev)
+	}
+	r.branch = ""
+	r.head = name
+	return r
+}
+
+func (r *Repo) addTag(name, rev string, annotated bool) *Repo {
+	commit := r.resolve(rev)
+	if commit == "" {
+		return r.fail("tag %q: unknown revision %q", name, rev)
+	}
+	for _, t := range r.tags {
+		if t.name == name {
+			return r.fail("tag %q already exists", name)
+		}
+	}
+	r.tags = append(r.tags, &tag{name: name, commit: commit, annotated: annotated})
+	return r
+}
+
+// Tag adds a lightweight tag at HEAD.
+func (r *Repo) Tag(name string) *Repo {
+	return r.addTag(name, "HEAD", false)
+}
+
+// TagAt adds a lightweight tag at the given commit, tag or branch.
+func (r *Repo) TagAt(name, rev string) *Repo {
+	return r.addTag(name, rev, false)
+}
+
+// AnnotatedTag adds an annotated tag at HEAD.
+func (r *Repo) AnnotatedTag(name string) *Repo {
+	return r.addTag(name, "HEAD", true)
+}
+
+// AnnotatedTagAt adds an annotated tag at the given commit, tag or branch.
+func (r *Repo) AnnotatedTagAt(name, rev string) *Repo {
+	return r.addTag(name, rev, true)
+}
+
+// Dirty makes the current tree differ from the tree at HEAD, as if
+// changes had been staged. It's tree key is DirtyTree.
+func (r *Repo) Dirty() *Repo {
+	r.dirty = true
+	return r
+}
+
+func (r *Repo) findTag(name string) *tag {
+	name = strings.TrimPrefix(name, "refs/")
+	name = strings.TrimPrefix(name, "tags/")
+	for _, t := range r.tags {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// resolve returns the name of the commit for "HEAD", a tag, a branch
+// or a commit name, in that order, or an empty string.
+func (r *Repo) resolve(rev string) string {
+	if rev == "HEAD" {
+		return r.headCommit()
+	}
+	if t := r.findTag(rev); t != nil {
+		return t.commit
+	}
+	if tip, ok := r.branches[strings.TrimPrefix(rev, "refs/heads/")]; ok {
+		return tip
+	}
+	if c := r.byName[rev]; c != nil {
+		return c.name
+	}
+	return ""
+}
+
+// ancestors returns the commits reachable from the named commit, including itself.
+func (r *Repo) ancestors(name string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := []string{name}
+	for len(stack) > 0 {
+		name, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if c := r.byName[name]; c != nil && !seen[name] {
+			seen[name] = true
+			stack = append(stack, c.parents...)
+		}
+	}
+	return seen
+}
+
+// index returns the position of the commit in creation order.
+func (r *Repo) index(name string) int {
+	for i, c := range r.commits {
+		if c.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckGitRepo returns the directory, since the Repo is everywhere.
+func (r *Repo) CheckGitRepo(dir string) (string, error) {
+	return dir, nil
+}
+
+// GetCommits returns the commits reachable from any branch, tag or HEAD, newest first.
+func (r *Repo) GetCommits(repo string) (commits []string) {
+	reachable := r.ancestors(r.headCommit())
+	for _, tip := range r.branches {
+		for name := range r.ancestors(tip) {
+			reachable[name] = true
+		}
+	}
+	for _, t := range r.tags {
+		for name := range r.ancestors(t.commit) {
+			reachable[name] = true
+		}
+	}
+	for i := len(r.commits) - 1; i >= 0; i-- {
+		if reachable[r.commits[i].name] {
+			commits = append(commits, r.commits[i].name)
+		}
+	}
+	return
+}
+
+// GetTags returns all tags, sorted by version descending like "git tag --sort=-v:refname".
+func (r *Repo) GetTags(repo string) (tags []string) {
+	for _, t := range r.tags {
+		tags = append(tags, t.name)
+	}
+	sort.Slice(tags, func(i, j int) bool { return versionLess(tags[j], tags[i]) })
+	return
+}
+
+// GetCurrentTreeHash returns the tree hash at HEAD, or of DirtyTree if the Repo is dirty.
+func (r *Repo) GetCurrentTreeHash(repo string) string {
+	if r.dirty {
+		return TreeHash(DirtyTree)
+	}
+	return r.GetTreeHash(repo, "HEAD")
+}
+
+// IsDirty returns true if Dirty was called.
+func (r *Repo) IsDirty(repo string) bool {
+	return r.dirty
+}
+
+// GetTreeHash returns the tree hash for the given tag, branch or commit.
+func (r *Repo) GetTreeHash(repo, rev string) string {
+	if c := r.byName[r.resolve(rev)]; c != nil {
+		return TreeHash(c.tree)
+	}
+	return ""
+}
+
+// GetCommit returns the commit name for the given tag, branch or commit.
+func (r *Repo) GetCommit(repo, rev string) string {
+	return r.resolve(rev)
+}
+
+// GetClosestTag returns the closest tag matching makeversion.DefaultTagPattern, see GetClosestTagMatch.
+func (r *Repo) GetClosestTag(repo, rev string) string {
+	return r.GetClosestTagMatch(repo, rev, "")
+}
+
+// GetClosestTagMatch returns the tag matching the glob pattern that "git describe"
+// would choose for the commit: the one with the fewest commits reachable
+// from the commit that aren't reachable from the tag, preferring newer
+// commits, annotated tags, newer annotated tags and lightweight tags
+// sorting first, in that order.
+func (r *Repo) GetClosestTagMatch(repo, rev, match string) string {
+	if match == "" {
+		match = makeversion.DefaultTagPattern
+	}
+	from := r.ancestors(r.resolve(rev))
+	var best *tag
+	bestDepth := 0
+	for _, t := range r.tags {
+		if ok, _ := path.Match(match, t.name); !ok || !from[t.commit] {
+			continue
+		}
+		depth := 0
+		covered := r.ancestors(t.commit)
+		for name := range from {
+			if !covered[name] {
+				depth++
+			}
+		}
+		if best == nil || depth < bestDepth || (depth == bestDepth && r.betterTag(t, best)) {
+			best, bestDepth = t, depth
+		}
+	}
+	if best != nil {
+		return best.name
+	}
+	return ""
+}
+
+// betterTag returns true if "git describe" would prefer tag a over tag b at the same depth.
+func (r *Repo) betterTag(a, b *tag) bool {
+	if a.commit != b.commit {
+		return r.index(a.commit) > r.index(b.commit)
+	}
+	if a.annotated != b.annotated {
+		return a.annotated
+	}
+	if a.annotated {
+		// the tag created last has the newest date
+		for _, t := range r.tags {
+			if t == a {
+				return false
+			}
+			if t == b {
+				return true
+			}
+		}
+	}
+	return a.name < b.name
+}
+
+// GetBranch returns the checked out branch, or an empty string if HEAD is detached.
+func (r *Repo) GetBranch(repo string) string {
+	return r.branch
+}
+
+// GetBranchesFromTag returns the branches containing the tag, sorted by name.
+// If the checked out branch contains it, only that branch is returned.
+func (r *Repo) GetBranchesFromTag(repo, tagName string) (branches []string) {
+	t := r.findTag(tagName)
+	if t == nil {
+		return
+	}
+	for name, tip := range r.branches {
+		if tip != "" && r.ancestors(tip)[t.commit] {
+			if name == r.branch {
+				return []string{name}
+			}
+			branches = append(branches, name)
+		}
+	}
+	sort.Strings(branches)
+	return
+}
+
+// GetBuild returns the number of commits reachable from HEAD, or an empty string if none.
+func (r *Repo) GetBuild(repo string) string {
+	if n := len(r.ancestors(r.headCommit())); n > 0 {
+		return strconv.Itoa(n)
+	}
+	return ""
+}
+
+// FetchTags does nothing, since the Repo has no remote.
+func (r *Repo) FetchTags(repo string) error {
+	return nil
+}
+
+// FetchTagsWithOptions does nothing, since the Repo has no remote.
+func (r *Repo) FetchTagsWithOptions(repo string, opts makeversion.FetchOptions) error {
+	return nil
+}
+
+// CheckAccess always succeeds.
+func (r *Repo) CheckAccess(repo string) error {
+	return nil
+}
+
+// IsShallow returns false.
+func (r *Repo) IsShallow(repo string) bool {
+	return false
+}
+
+// GetTagType returns "tag" for an annotated tag, "commit" for a lightweight tag, or an empty string.
+func (r *Repo) GetTagType(repo, tagName string) string {
+	if t := r.findTag(tagName); t != nil {
+		if t.annotated {
+			return "tag"
+		}
+		return "commit"
+	}
+	return ""
+}
+
+// GetRemoteTags fails, since the Repo has no remote.
+func (r *Repo) GetRemoteTags(repo, remote string) ([]string, error) {
+	return nil, errors.New("no remote repository")
+}
+
+// versionLess compares tag names like "git tag --sort=v:refname" does,
+// comparing runs of digits by their numeric value.
+func versionLess(a, b string) bool {
+	for a != "" && b != "" {
+		ra, rb := leadingRun(a), leadingRun(b)
+		if isDigit(ra[0]) && isDigit(rb[0]) {
+			na := strings.TrimLeft(ra, "0")
+			nb := strings.TrimLeft(rb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+		} else if ra != rb {
+			return ra < rb
+		}
+		a, b = a[len(ra):], b[len(rb):]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// leadingRun returns the leading run of digits or non-digits in s.
+func leadingRun(s string) string {
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,103 @@
+package makeversiontest
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/cparta/makeversion/v2"
+	"github.com/matryer/is"
+)
+
+func Test_Repo_Builder(t *testing.T) {
+	is := is.New(t)
+	r := NewRepo().
+		Commit("a").Tag("v1.0.0").
+		Commit("b").
+		Branch("feature").Commit("c").AnnotatedTag("v1.1.0-rc1").
+		Checkout("main").CommitSameTree("d", "a").
+		Merge("feature", "e")
+	is.NoErr(r.Err())
+
+	is.Equal([]string{"e", "d", "c", "b", "a"}, r.GetCommits("."))
+	is.Equal([]string{"v1.1.0-rc1", "v1.0.0"}, r.GetTags("."))
+	is.Equal("main", r.GetBranch("."))
+	is.Equal("5", r.GetBuild("."))
+	is.Equal(TreeHash("e"), r.GetCurrentTreeHash("."))
+	is.Equal(r.GetTreeHash(".", "a"), r.GetTreeHash(".", "d"))
+	is.Equal(r.GetTreeHash(".", "v1.0.0"), r.GetTreeHash(".", "d"))
+	is.Equal("c", r.GetCommit(".", "v1.1.0-rc1"))
+	is.Equal("v1.1.0-rc1", r.GetClosestTagMatch(".", "HEAD", "v*"))
+	is.Equal("v1.0.0", r.GetClosestTag(".", "d"))
+	is.Equal([]string{"main"}, r.GetBranchesFromTag(".", "v1.0.0"))
+	is.Equal("tag", r.GetTagType(".", "v1.1.0-rc1"))
+	is.Equal("commit", r.GetTagType(".", "refs/tags/v1.0.0"))
+
+	r.Detach("b").Dirty()
+	is.Equal("", r.GetBranch("."))
+	is.Equal([]string{"feature", "main"}, r.GetBranchesFromTag(".", "v1.0.0"))
+	is.Equal(TreeHash(DirtyTree), r.GetCurrentTreeHash("."))
+	is.True(r.IsDirty("."))
+
+	vi, err := r.VersionStringer(Environment{"CI_COMMIT_REF_NAME": "release"}).GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v1.0.0-release.2", vi.Version)
+}
+
+func Test_Repo_Mistakes(t *testing.T) {
+	is := is.New(t)
+	is.True(NewRepo().Commit("a").Commit("a").Err() != nil)
+	is.True(NewRepo().Checkout("nope").Err() != nil)
+	is.True(NewRepo().Tag("v1.0.0").Err() != nil)
+	r := NewRepo().Commit("a").Merge("nope", "b")
+	is.True(r.Err() != nil)
+	_, err := r.VersionStringer(Environment{}).GetVersion(".")
+	is.True(err != nil)
+	_, err = r.Materialize("git", t.TempDir())
+	is.True(err != nil)
+}
+
+func Test_versionLess(t *testing.T) {
+	is := is.New(t)
+	tags := []string{"v1.10.0", "v1.2.0", "v1.2.0-rc1", "v0.9", "v10.0.0", "other"}
+	sort.Slice(tags, func(i, j int) bool { return versionLess(tags[i], tags[j]) })
+	is.Equal([]string{"other", "v0.9", "v1.2.0", "v1.2.0-rc1", "v1.10.0", "v10.0.0"}, tags)
+}
+
+func Test_Repo_Materialize(t *testing.T) {
+	is := is.New(t)
+	r := NewRepo().
+		Commit("a").AnnotatedTag("v1.0.0").
+		Commit("b").Tag("v1.1.0").
+		Branch("feature").Commit("c").
+		Checkout("main").CommitSameTree("d", "a").
+		Merge("feature", "e").
+		Detach("d").Dirty()
+	dir := t.TempDir()
+	hashes, err := r.Materialize("git", dir)
+	is.NoErr(err)
+
+	dg, err := makeversion.NewDefaultGitter("git")
+	is.NoErr(err)
+	unhash := make(map[string]string)
+	for name, hash := range hashes {
+		unhash[hash] = name
+	}
+	is.Equal(r.GetTags("."), dg.GetTags(dir))
+	is.Equal(r.GetBranch("."), dg.GetBranch(dir))
+	is.Equal(r.GetBuild("."), dg.GetBuild(dir))
+	is.Equal(r.GetCurrentTreeHash("."), unhash[dg.GetCurrentTreeHash(dir)])
+	for _, rev := range []string{"a", "b", "c", "d", "e", "v1.0.0", "v1.1.0"} {
+		realRev := rev
+		if hash, ok := hashes[rev]; ok {
+			realRev = hash
+		}
+		is.Equal(r.GetTreeHash(".", rev), unhash[dg.GetTreeHash(dir, realRev)])
+	}
+	for _, tag := range r.GetTags(".") {
+		is.Equal(r.GetTagType(".", tag), dg.(makeversion.TagTyper).GetTagType(dir, tag))
+		is.Equal(r.GetBranchesFromTag(".", tag), dg.GetBranchesFromTag(dir, tag))
+	}
+	is.Equal(r.GetClosestTag(".", "HEAD"), dg.GetClosestTag(dir, "HEAD"))
+	is.Equal(r.GetClosestTag(".", "e"), dg.GetClosestTag(dir, hashes["e"]))
+	is.Equal(r.IsDirty("."), dg.(makeversion.DirtyChecker).IsDirty(dir))
+}
@@ -4,6 +4,7 @@ package makeversion
 
 import (
 	"os"
+	"path"
 	"strings"
 )
 
@@ -35,9 +36,13 @@ var mockHistory = []mockCommit{
 }
 
 type MockGitter struct {
-	branch   string
-	treehash string
-	TopTag   string
+	branch     string
+	treehash   string
+	TopTag     string
+	accessErr  error
+	shallow    bool
+	remoteTags []string
+	remoteErr  error
 }
 
 func (mg *MockGitter) CheckGitRepo(dir string) (repo string, err error) {
@@ -89,11 +94,18 @@ func (mg *MockGitter) GetTreeHash(repo, tag string) string {
 }
 
 func (mg *MockGitter) GetClosestTag(repo, commit string) (tag string) {
-	if repo == "." {
+	return mg.GetClosestTagMatch(repo, commit, "")
+}
+
+func (mg *MockGitter) GetClosestTagMatch(repo, commit, match string) (tag string) {
+	if match == "" {
+		match = DefaultTagPattern
+	}
+	if repo == "." && !mg.shallow {
 		for i := range mockHistory {
 			if mockHistory[i].commithash == commit {
 				for i < len(mockHistory) {
-					if mockHistory[i].tag != "" {
+					if ok, _ := path.Match(match, mockHistory[i].tag); ok {
 						return mockHistory[i].tag
 					}
 					i++
@@ -124,6 +136,17 @@ func (mg *MockGitter) GetBranchesFromTag(repo, tag string) (branches []string) {
 	return
 }
 
+func (mg *MockGitter) GetCommit(repo, rev string) string {
+	if repo == "." {
+		for _, h := range mockHistory {
+			if h.commithash == rev || (h.tag != "" && h.tag == rev) {
+				return h.commithash
+			}
+		}
+	}
+	return ""
+}
+
 func (mg *MockGitter) GetBuild(repo string) string {
 	if repo == "." {
 		return "build"
@@ -135,4 +158,30 @@ func (mg *MockGitter) FetchTags(repo string) error {
 	return nil
 }
 
+func (mg *MockGitter) CheckAccess(repo string) error {
+	return mg.accessErr
+}
+
+func (mg *MockGitter) IsShallow(repo string) bool {
+	return mg.shallow
+}
+
+func (mg *MockGitter) GetTagType(repo, tag string) string {
+	if repo == "." {
+		for _, h := range mockHistory {
+			if h.tag == tag {
+				if tag == "v2.0.0" {
+					return "commit"
+				}
+				return "tag"
+			}
+		}
+	}
+	return ""
+}
+
+func (mg *MockGitter) GetRemoteTags(repo, remote string) ([]string, error) {
+	return mg.remoteTags, mg.remoteErr
+}
+
 var _ Gitter = &MockGitter{}
@@ -0,0 +1,154 @@
+package makeversion
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OCI image annotation keys set by VersionInfo.OCIAnnotations.
+const (
+	OCIAnnotationVersion  = "org.opencontainers.image.version"
+	OCIAnnotationRevision = "org.opencontainers.image.revision"
+	OCIAnnotationCreated  = "org.opencontainers.image.created"
+)
+
+// OCI formats for mkver -format. Only FormatOCITags is accepted by
+// VersionInfo.Format, since the annotations also need the revision
+// and creation time.
+const (
+	FormatOCITags        = "oci-tags"        // image tags, one per line
+	FormatOCILabels      = "oci-labels"      // annotations as "--label key=value" arguments, one per line
+	FormatOCIAnnotations = "oci-annotations" // annotations as a JSON object
+)
+
+// reOCITag matches valid OCI image tags.
+var reOCITag = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// OCITagOptions describe the repository a version was built in, for OCITags.
+type OCITagOptions struct {
+	MaxBranchLength int      // longest branch tag, as for SanitizeBranchLength, or 0 for MaxBranchTextLength
+	Maintenance     bool     // the branch is a maintenance branch, so the version isn't "latest"
+	Versions        []string // the versions tagged in the repository
+}
+
+// OCITagOptions returns the OCITagOptions for a version built in the
+// repository, using the configured maximum branch length, maintenance
+// branch pattern and version tags.
+func (vs *VersionStringer) OCITagOptions(repo string, vi *VersionInfo) (opts OCITagOptions) {
+	cfg := vs.GetConfig()
+	opts.MaxBranchLength = cfg.MaxBranchLength
+	_, _, opts.Maintenance = vs.GetMaintenanceLine(vi.Branch)
+	for _, tag := range vs.Git.GetTags(repo) {
+		if ok, _ := path.Match(cfg.TagPattern, tag); ok {
+			opts.Versions = append(opts.Versions, DefaultTagPrefix+strings.TrimPrefix(tag, cfg.TagPrefix))
+		}
+	}
+	return
+}
+
+// OCITags returns the image tags to push for the version:
+//
+//   - the version without the "v", with build metadata following a dash
+//     instead of a plus, e.g. "1.2.3-feature.45"
+//   - for releases that aren't prereleases, the major and minor version,
+//     the major version and "latest", e.g. "1.2", "1" and "latest", each
+//     unless a higher release in opts.Versions should have it, and "latest"
+//     not for maintenance branches
+//   - the branch name as made by SanitizeBranchLength, or "pr-123" for pull
+//     requests, unless it would be "latest"
+//
+// Returns an error if the version isn't a semantic version, or if a tag
+// doesn't match the OCI tag grammar, e.g. because it is too long.
+func (vi *VersionInfo) OCITags(opts OCITagOptions) (tags []string, err error) {
+	var sv Semver
+	if sv, err = ParseSemver(vi.Version); err == nil {
+		seen := make(map[string]bool)
+		add := func(tag string) {
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		add(strings.ReplaceAll(sv.NPM(), "+", "-"))
+		if vi.Release && sv.Pre == "" {
+			var higher, higherMajor, higherMinor bool
+			for _, version := range opts.Versions {
+				if other, e := ParseSemver(version); e == nil && other.Pre == "" && releaseLess(sv, other) {
+					higher = true
+					higherMajor = higherMajor || other.Major == sv.Major
+					higherMinor = higherMinor || (other.Major == sv.Major && other.Minor == sv.Minor)
+				}
+			}
+			if !higherMinor {
+				add(fmt.Sprintf("%d.%d", sv.Major, sv.Minor))
+			}
+			if !higherMajor {
+				add(fmt.Sprintf("%d", sv.Major))
+			}
+			if !higher && !opts.Maintenance {
+				add("latest")
+			}
+		}
+		maxLength := opts.MaxBranchLength
+		if maxLength == 0 {
+			maxLength = MaxBranchTextLength
+		}
+		branchTag := SanitizeBranchLength(vi.Branch, maxLength)
+		if vi.PullRequest != "" {
+			branchTag = SanitizeBranchLength("pr-"+vi.PullRequest, maxLength)
+		}
+		if branchTag != "latest" {
+			add(branchTag)
+		}
+		for _, tag := range tags {
+			if !reOCITag.MatchString(tag) {
+				return nil, fmt.Errorf("%q is not a valid OCI image tag", tag)
+			}
+		}
+	}
+	return
+}
+
+// releaseLess returns true if the major, minor and patch version of a is lower than that of b.
+func releaseLess(a, b Semver) bool {
+	if a.Major != b.Major {
+		return a.Major < b.Major
+	}
+	if a.Minor != b.Minor {
+		return a.Minor < b.Minor
+	}
+	return a.Patch < b.Patch
+}
+
+// OCIAnnotations returns the OCI image annotations for the version, the
+// given revision (commit hash) and image creation time. The revision and
+// creation time are left out if empty or zero.
+func (vi *VersionInfo) OCIAnnotations(revision string, created time.Time) map[string]string {
+	annotations := map[string]string{OCIAnnotationVersion: vi.Version}
+	if revision != "" {
+		annotations[OCIAnnotationRevision] = revision
+	}
+	if !created.IsZero() {
+		annotations[OCIAnnotationCreated] = created.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
+
+// OCILabelArgs returns the annotations as "--label key=value" arguments for
+// docker build or buildah, one per line, sorted by key.
+func OCILabelArgs(annotations map[string]string) string {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "--label %s=%s\n", key, annotations[key])
+	}
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package makeversion
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func Test_VersionInfo_OCITags(t *testing.T) {
+	is := is.New(t)
+	for _, tc := range []struct {
+		vi   VersionInfo
+		opts OCITagOptions
+		tags []string
+	}{
+		{VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}, OCITagOptions{}, []string{"1.2.3", "1.2", "1", "latest", "main"}},
+		{VersionInfo{Version: "v1.2.3-main.45", Branch: "main"}, OCITagOptions{}, []string{"1.2.3-main.45", "main"}},
+		{VersionInfo{Version: "v2.0.0-rc.1", Branch: "main", Release: true}, OCITagOptions{}, []string{"2.0.0-rc.1", "main"}},
+		{VersionInfo{Version: "v1.2.3-feature-x.45+dirty", Branch: "Feature/X"}, OCITagOptions{}, []string{"1.2.3-feature-x.45-dirty", "feature-x"}},
+		{VersionInfo{Version: "v1.2.3-pr.12.45", Branch: "12/merge", PullRequest: "12"}, OCITagOptions{}, []string{"1.2.3-pr.12.45", "pr-12"}},
+		{VersionInfo{Version: "v1.2.3-latest.45", Branch: "latest"}, OCITagOptions{}, []string{"1.2.3-latest.45"}},
+		{VersionInfo{Version: "v1.2.3", Release: true}, OCITagOptions{}, []string{"1.2.3", "1.2", "1", "latest"}},
+		// higher releases keep their tags, prereleases don't count
+		{VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}, OCITagOptions{Versions: []string{"v1.2.3", "v1.3.0", "v0.9.0"}}, []string{"1.2.3", "1.2", "main"}},
+		{VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}, OCITagOptions{Versions: []string{"v1.2.4"}}, []string{"1.2.3", "main"}},
+		{VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}, OCITagOptions{Versions: []string{"v2.0.0", "v1.2.3"}}, []string{"1.2.3", "1.2", "1", "main"}},
+		{VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}, OCITagOptions{Versions: []string{"v1.3.0-rc.1", "nonsense"}}, []string{"1.2.3", "1.2", "1", "latest", "main"}},
+		{VersionInfo{Version: "v1.2.3", Branch: "release/1.2", Release: true}, OCITagOptions{Maintenance: true}, []string{"1.2.3", "1.2", "1", "release-1-2"}},
+		{VersionInfo{Version: "v1.2.3-feature.45", Branch: strings.Repeat("feature", 5)}, OCITagOptions{MaxBranchLength: 16},
+			[]string{"1.2.3-feature.45", SanitizeBranchLength(strings.Repeat("feature", 5), 16)}},
+	} {
+		tags, err := tc.vi.OCITags(tc.opts)
+		is.NoErr(err)
+		is.Equal(tc.tags, tags)
+		for _, tag := range tags {
+			is.True(reOCITag.MatchString(tag))
+		}
+	}
+
+	vi := VersionInfo{Version: "v1.2.3-" + strings.Repeat("x", 130)}
+	_, err := vi.OCITags(OCITagOptions{})
+	is.True(err != nil) // too long
+
+	vi.Version = "v1"
+	_, err = vi.OCITags(OCITagOptions{})
+	is.True(err != nil)
+
+	vi = VersionInfo{Version: "v1.2.3", Branch: "main", Release: true}
+	s, err := vi.Format(FormatOCITags)
+	is.NoErr(err)
+	is.Equal("1.2.3\n1.2\n1\nlatest\nmain", s)
+}
+
+func Test_VersionStringer_OCITagOptions(t *testing.T) {
+	is := is.New(t)
+	vs := &VersionStringer{Git: &MockGitter{}, Env: MockEnvironment{},
+		Config: &Config{MaintenanceBranch: DefaultMaintenanceBranch, MaxBranchLength: 20}}
+	opts := vs.OCITagOptions(".", &VersionInfo{Version: "v4.0.0", Branch: "release/4.0", Release: true})
+	is.Equal(OCITagOptions{MaxBranchLength: 20, Maintenance: true, Versions: []string{"v6.0.0", "v4.0.0", "v2.0.0"}}, opts)
+
+	vs.Config = &Config{TagPattern: "v[4-9]*"}
+	opts = vs.OCITagOptions(".", &VersionInfo{Version: "v6.0.0", Branch: "main", Release: true})
+	is.Equal(OCITagOptions{MaxBranchLength: MaxBranchTextLength, Versions: []string{"v6.0.0", "v4.0.0"}}, opts)
+}
+
+func Test_VersionInfo_OCIAnnotations(t *testing.T) {
+	is := is.New(t)
+	vi := VersionInfo{Version: "v1.2.3"}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	annotations := vi.OCIAnnotations("abc123", created)
+	is.Equal(map[string]string{
+		OCIAnnotationVersion:  "v1.2.3",
+		OCIAnnotationRevision: "abc123",
+		OCIAnnotationCreated:  "2024-01-02T02:04:05Z",
+	}, annotations)
+	is.Equal(OCILabelArgs(annotations), "--label org.opencontainers.image.created=2024-01-02T02:04:05Z\n"+
+		"--label org.opencontainers.image.revision=abc123\n"+
+		"--label org.opencontainers.image.version=v1.2.3\n")
+
+	annotations = vi.OCIAnnotations("", time.Time{})
+	is.Equal(map[string]string{OCIAnnotationVersion: "v1.2.3"}, annotations)
+}
@@ -0,0 +1,78 @@
+package makeversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+)
+
+// ReleaseBranch is a pattern for branch names that are allowed to use
+// release mode. In a configuration file it is either a string holding a
+// glob pattern, or an object with a "pattern" or "regex" key and an
+// optional "channel".
+type ReleaseBranch struct {
+	Pattern string         `json:"pattern,omitempty"` // glob pattern, e.g. "release/*"
+	Regex   string         `json:"regex,omitempty"`   // regular expression, used if Pattern is empty
+	Channel string         `json:"channel,omitempty"` // prerelease identifier used instead of the branch name, e.g. "rc"
+	re      *regexp.Regexp // Regex, compiled by Validate
+}
+
+// UnmarshalJSON accepts either a glob pattern string or an object.
+func (rb *ReleaseBranch) UnmarshalJSON(b []byte) (err error) {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '"' {
+		*rb = ReleaseBranch{}
+		return json.Unmarshal(b, &rb.Pattern)
+	}
+	type plain ReleaseBranch
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var p plain
+	if err = dec.Decode(&p); err == nil {
+		*rb = ReleaseBranch(p)
+	}
+	return
+}
+
+// Validate checks that exactly one of Pattern and Regex is set and that it
+// compiles. The compiled Regex is kept for Match.
+func (rb *ReleaseBranch) Validate() (err error) {
+	switch {
+	case rb.Pattern != "" && rb.Regex != "":
+		err = errors.New("both pattern and regex given")
+	case rb.Pattern != "":
+		_, err = path.Match(rb.Pattern, "")
+	case rb.Regex != "":
+		rb.re, err = regexp.Compile(rb.Regex)
+	default:
+		err = errors.New("missing pattern or regex")
+	}
+	return
+}
+
+// Match returns true if the branch name matches the pattern. If Validate
+// hasn't compiled the Regex, it is compiled for each call. An entry that
+// doesn't validate matches no branch.
+func (rb *ReleaseBranch) Match(branchName string) (ok bool) {
+	switch {
+	case rb.Pattern != "" && rb.Regex != "":
+	case rb.Pattern != "":
+		ok, _ = path.Match(rb.Pattern, branchName)
+	case rb.Regex != "":
+		re, err := rb.re, error(nil)
+		if re == nil {
+			re, err = regexp.Compile(rb.Regex)
+		}
+		ok = err == nil && re.MatchString(branchName)
+	}
+	return
+}
+
+// String returns the glob pattern, or the regular expression enclosed in slashes.
+func (rb ReleaseBranch) String() string {
+	if rb.Pattern != "" {
+		return rb.Pattern
+	}
+	return "/" + rb.Regex + "/"
+}
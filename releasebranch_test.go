@@ -0,0 +1,54 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ReleaseBranch_UnmarshalJSON(t *testing.T) {
+	is := is.New(t)
+	var rbs []ReleaseBranch
+	is.NoErr(json.Unmarshal([]byte(`["main", {"pattern": "release/*", "channel": "rc"}, {"regex": "^hotfix/"}]`), &rbs))
+	is.Equal([]ReleaseBranch{
+		{Pattern: "main"},
+		{Pattern: "release/*", Channel: "rc"},
+		{Regex: "^hotfix/"},
+	}, rbs)
+	is.True(json.Unmarshal([]byte(`[{"glob": "x"}]`), &rbs) != nil)
+	is.True(json.Unmarshal([]byte(`[1]`), &rbs) != nil)
+}
+
+func Test_ReleaseBranch_Validate(t *testing.T) {
+	is := is.New(t)
+	is.NoErr((&ReleaseBranch{Pattern: "release/*"}).Validate())
+	is.NoErr((&ReleaseBranch{Regex: "^release/"}).Validate())
+	is.True((&ReleaseBranch{}).Validate() != nil)
+	is.True((&ReleaseBranch{Pattern: "x", Regex: "x"}).Validate() != nil)
+	is.True((&ReleaseBranch{Pattern: "[x"}).Validate() != nil)
+	is.True((&ReleaseBranch{Regex: "("}).Validate() != nil)
+}
+
+func Test_ReleaseBranch_Match(t *testing.T) {
+	is := is.New(t)
+	glob := ReleaseBranch{Pattern: "release/*"}
+	is.True(glob.Match("release/1.4"))
+	is.True(!glob.Match("release/1.4/fix"))
+	is.True(!glob.Match("main"))
+	is.Equal("release/*", glob.String())
+
+	re := ReleaseBranch{Regex: `^(release|hotfix)/\d+\.\d+$`}
+	is.True(re.Match("hotfix/1.4"))
+	is.True(!re.Match("hotfix/x"))
+	is.Equal(`/^(release|hotfix)/\d+\.\d+$/`, re.String())
+
+	is.NoErr(re.Validate())
+	is.True(re.re != nil) // compiled once
+	is.True(re.Match("release/2.0"))
+
+	// entries that don't validate match no branch
+	is.True(!(&ReleaseBranch{Regex: "("}).Match("("))
+	is.True(!(&ReleaseBranch{Channel: "rc"}).Match("main"))
+	is.True(!(&ReleaseBranch{Pattern: "main", Regex: "main"}).Match("main"))
+}
@@ -0,0 +1,459 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitterCall is a call to a Gitter method and it's result, as recorded
+// by a RecordingGitter. The repository argument isn't recorded, so
+// fixtures can be replayed anywhere.
+type GitterCall struct {
+	Method string          `json:"method"`
+	Args   []string        `json:"args,omitempty"`   // arguments following the repository
+	Result json.RawMessage `json:"result,omitempty"` // the result as JSON
+	Error  string          `json:"error,omitempty"`  // the error message, if it failed
+}
+
+// key returns a string identifying the method and arguments.
+func (gc GitterCall) key() string {
+	return gc.Method + "(" + strings.Join(gc.Args, ", ") + ")"
+}
+
+// GitterFixture is the JSON file written by RecordingGitter and read by ReplayGitter.
+type GitterFixture struct {
+	Calls []GitterCall       `json:"calls"`
+	Env   map[string]*string `json:"env,omitempty"` // CI environment variables looked up, nil if not set
+}
+
+// ciEnvVars are the environment variables other than defaultBranchEnvVars,
+// tagEnvVars and buildEnvVars that CI systems use to describe the build.
+var ciEnvVars = []string{
+	"CI", "CI_SYSTEM_NAME", "FORGEJO_ACTIONS", "GITEA_ACTIONS", "GITHUB_ACTIONS", "GITLAB_CI",
+	"BUILDKITE", "CIRCLECI", "DRONE", "TF_BUILD", "TEAMCITY_VERSION",
+	"GITHUB_REF_NAME", "GITHUB_REF_TYPE", "GITHUB_REF_PROTECTED", "GITHUB_EVENT_NAME",
+	"CI_COMMIT_REF_NAME", "CI_COMMIT_REF_PROTECTED", "CI_MERGE_REQUEST_IID",
+	"BUILDKITE_BRANCH", "CIRCLE_BRANCH", "DRONE_BRANCH",
+}
+
+// secretEnvVars are the environment variables CI systems use to describe
+// the build just by being set. Fixtures record them as empty.
+var secretEnvVars = []string{"FORGEJO_TOKEN"}
+
+// isCIEnvVar returns true for the environment variables CI systems use to
+// describe the build. Only these are recorded in fixtures.
+func isCIEnvVar(key string) bool {
+	return isSecretEnvVar(key) || isOneOf(key, ciEnvVars, defaultBranchEnvVars, tagEnvVars, buildEnvVars)
+}
+
+func isSecretEnvVar(key string) bool {
+	return isOneOf(key, secretEnvVars)
+}
+
+// isOneOf returns true if key is in any of the lists.
+func isOneOf(key string, lists ...[]string) bool {
+	for _, envVars := range lists {
+		for _, envVar := range envVars {
+			if key == envVar {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RecordingGitter is a Gitter that passes calls on to another Gitter
+// and records them, so they can be saved as a fixture for a ReplayGitter.
+// It is safe for concurrent use if the Gitter it wraps is.
+type RecordingGitter struct {
+	Gitter Gitter
+	mu     sync.Mutex
+	calls  []GitterCall
+	envs   []*recordingEnv
+	parent *RecordingGitter // records the calls instead, if set by RecordErrors
+}
+
+// NewRecordingGitter returns a RecordingGitter recording the calls to git.
+func NewRecordingGitter(git Gitter) *RecordingGitter {
+	return &RecordingGitter{Gitter: git}
+}
+
+// RecordErrors returns a RecordingGitter recording to this one, that
+// stores the first error the wrapped Gitter can't return in *err.
+func (rg *RecordingGitter) RecordErrors(err *error) Gitter {
+	return &RecordingGitter{Gitter: recordErrors(rg.Gitter, err), parent: rg.root()}
+}
+
+// root returns the RecordingGitter that records the calls.
+func (rg *RecordingGitter) root() *RecordingGitter {
+	if rg.parent != nil {
+		return rg.parent
+	}
+	return rg
+}
+
+// Environment returns an Environment that passes lookups on to env, and
+// records those of CI environment variables in the fixture. The values of
+// secrets like FORGEJO_TOKEN are recorded as empty.
+func (rg *RecordingGitter) Environment(env Environment) Environment {
+	re := &recordingEnv{Environment: env, seen: make(map[string]*string), only: isCIEnvVar, redact: isSecretEnvVar}
+	rg = rg.root()
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	rg.envs = append(rg.envs, re)
+	return re
+}
+
+// Fixture returns the calls and environment variable lookups recorded so far.
+func (rg *RecordingGitter) Fixture() *GitterFixture {
+	rg = rg.root()
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	fixture := &GitterFixture{Calls: append([]GitterCall(nil), rg.calls...)}
+	for _, re := range rg.envs {
+		for key, val := range re.values() {
+			if fixture.Env == nil {
+				fixture.Env = make(map[string]*string)
+			}
+			fixture.Env[key] = val
+		}
+	}
+	return fixture
+}
+
+// Save writes the calls recorded so far to the given JSON file.
+func (rg *RecordingGitter) Save(fileName string) (err error) {
+	var b []byte
+	if b, err = json.MarshalIndent(rg.Fixture(), "", "  "); err == nil {
+		err = os.WriteFile(fileName, append(b, '\n'), 0600)
+	}
+	return
+}
+
+func (rg *RecordingGitter) record(method string, result interface{}, err error, args ...string) {
+	call := GitterCall{Method: method, Args: args}
+	if result != nil {
+		call.Result, _ = json.Marshal(result)
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	rg = rg.root()
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	rg.calls = append(rg.calls, call)
+}
+
+func (rg *RecordingGitter) CheckGitRepo(dir string) (repo string, err error) {
+	repo, err = rg.Gitter.CheckGitRepo(dir)
+	rg.record("CheckGitRepo", nil, err)
+	return
+}
+
+func (rg *RecordingGitter) GetCommits(repo string) (commits []string) {
+	commits = rg.Gitter.GetCommits(repo)
+	rg.record("GetCommits", commits, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetTags(repo string) (tags []string) {
+	tags = rg.Gitter.GetTags(repo)
+	rg.record("GetTags", tags, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetCurrentTreeHash(repo string) (hash string) {
+	hash = rg.Gitter.GetCurrentTreeHash(repo)
+	rg.record("GetCurrentTreeHash", hash, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetTreeHash(repo, tag string) (hash string) {
+	hash = rg.Gitter.GetTreeHash(repo, tag)
+	rg.record("GetTreeHash", hash, nil, tag)
+	return
+}
+
+func (rg *RecordingGitter) GetCommit(repo, rev string) (hash string) {
+	hash = getCommit(rg.Gitter, repo, rev)
+	rg.record("GetCommit", hash, nil, rev)
+	return
+}
+
+func (rg *RecordingGitter) GetClosestTag(repo, commit string) (tag string) {
+	tag = rg.Gitter.GetClosestTag(repo, commit)
+	rg.record("GetClosestTag", tag, nil, commit)
+	return
+}
+
+func (rg *RecordingGitter) GetClosestTagMatch(repo, commit, match string) (tag string) {
+	tag = closestTag(rg.Gitter, repo, commit, match)
+	rg.record("GetClosestTagMatch", tag, nil, commit, match)
+	return
+}
+
+func (rg *RecordingGitter) IsDirty(repo string) (dirty bool) {
+	dirty = isDirty(rg.Gitter, repo)
+	rg.record("IsDirty", dirty, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetBranch(repo string) (branch string) {
+	branch = rg.Gitter.GetBranch(repo)
+	rg.record("GetBranch", branch, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetBranchesFromTag(repo, tag string) (branches []string) {
+	branches = rg.Gitter.GetBranchesFromTag(repo, tag)
+	rg.record("GetBranchesFromTag", branches, nil, tag)
+	return
+}
+
+func (rg *RecordingGitter) GetBuild(repo string) (build string) {
+	build = rg.Gitter.GetBuild(repo)
+	rg.record("GetBuild", build, nil)
+	return
+}
+
+func (rg *RecordingGitter) FetchTags(repo string) (err error) {
+	err = rg.Gitter.FetchTags(repo)
+	rg.record("FetchTags", nil, err)
+	return
+}
+
+func (rg *RecordingGitter) FetchTagsWithOptions(repo string, opts FetchOptions) (err error) {
+	err = fetchTags(rg.Gitter, repo, opts)
+	rg.record("FetchTagsWithOptions", nil, err, opts.args()...)
+	return
+}
+
+func (rg *RecordingGitter) CheckAccess(repo string) (err error) {
+	err = checkAccess(rg.Gitter, repo)
+	rg.record("CheckAccess", nil, err)
+	return
+}
+
+func (rg *RecordingGitter) IsShallow(repo string) (shallow bool) {
+	shallow = isShallow(rg.Gitter, repo)
+	rg.record("IsShallow", shallow, nil)
+	return
+}
+
+func (rg *RecordingGitter) GetTagType(repo, tag string) (objtype string) {
+	objtype = getTagType(rg.Gitter, repo, tag)
+	rg.record("GetTagType", objtype, nil, tag)
+	return
+}
+
+func (rg *RecordingGitter) GetRemoteTags(repo, remote string) (tags []string, err error) {
+	tags, err = getRemoteTags(rg.Gitter, repo, remote)
+	rg.record("GetRemoteTags", tags, err, remote)
+	return
+}
+
+// ReplayGitter is a Gitter that answers calls from a fixture recorded by
+// a RecordingGitter, regardless of the repository. If a method is called
+// several times with the same arguments, the recorded results are returned
+// in order, repeating the last one. Recorded errors are returned with the
+// same message, but not the same type.
+//
+// Calls that weren't recorded return empty results, and make Err return
+// an error. GetVersion returns it if the call was made by GetVersion.
+type ReplayGitter struct {
+	mu     sync.Mutex
+	calls  map[string][]GitterCall
+	env    fixtureEnv
+	err    error
+	parent *ReplayGitter // answers the calls instead, if set by RecordErrors
+	errs   *error        // set by RecordErrors
+}
+
+// NewReplayGitter returns a ReplayGitter answering from the fixture.
+func NewReplayGitter(fixture *GitterFixture) *ReplayGitter {
+	rp := &ReplayGitter{calls: make(map[string][]GitterCall), env: fixtureEnv(fixture.Env)}
+	for _, call := range fixture.Calls {
+		rp.calls[call.key()] = append(rp.calls[call.key()], call)
+	}
+	return rp
+}
+
+// LoadReplayGitter returns a ReplayGitter answering from the given fixture file.
+func LoadReplayGitter(fileName string) (rp *ReplayGitter, err error) {
+	var b []byte
+	if b, err = os.ReadFile(filepath.Clean(fileName)); err == nil /* #nosec G304 */ {
+		var fixture GitterFixture
+		if err = json.Unmarshal(b, &fixture); err == nil {
+			rp = NewReplayGitter(&fixture)
+		}
+	}
+	return
+}
+
+// RecordErrors returns a ReplayGitter answering from this one, that
+// stores an error naming the first call that wasn't recorded in *err.
+func (rp *ReplayGitter) RecordErrors(err *error) Gitter {
+	if rp.parent != nil {
+		rp = rp.parent
+	}
+	return &ReplayGitter{parent: rp, errs: err}
+}
+
+// Environment returns an Environment with the CI environment
+// variables recorded in the fixture, and no others.
+func (rp *ReplayGitter) Environment() Environment {
+	if rp.parent != nil {
+		rp = rp.parent
+	}
+	return rp.env
+}
+
+// fixtureEnv is an Environment with the variables recorded in a fixture.
+type fixtureEnv map[string]*string
+
+func (fe fixtureEnv) Getenv(key string) string {
+	val, _ := fe.LookupEnv(key)
+	return val
+}
+
+func (fe fixtureEnv) LookupEnv(key string) (string, bool) {
+	if val := fe[key]; val != nil {
+		return *val, true
+	}
+	return "", false
+}
+
+// Err returns an error naming the first call that wasn't recorded, or nil.
+func (rp *ReplayGitter) Err() error {
+	if rp.parent != nil {
+		rp = rp.parent
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.err
+}
+
+// replay stores the recorded result of the call in result, and returns the recorded error.
+func (rp *ReplayGitter) replay(method string, result interface{}, args ...string) (err error) {
+	key := GitterCall{Method: method, Args: args}.key()
+	errs := rp.errs
+	if rp.parent != nil {
+		rp = rp.parent
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	calls := rp.calls[key]
+	if len(calls) == 0 {
+		notRecorded := fmt.Errorf("no recorded result for %s", key)
+		if rp.err == nil {
+			rp.err = notRecorded
+		}
+		if errs != nil && *errs == nil {
+			*errs = notRecorded
+		}
+		return
+	}
+	call := calls[0]
+	if len(calls) > 1 {
+		rp.calls[key] = calls[1:]
+	}
+	if len(call.Result) > 0 {
+		_ = json.Unmarshal(call.Result, result)
+	}
+	if call.Error != "" {
+		err = errors.New(call.Error)
+	}
+	return
+}
+
+func (rp *ReplayGitter) CheckGitRepo(dir string) (repo string, err error) {
+	err = rp.replay("CheckGitRepo", nil)
+	return dir, err
+}
+
+func (rp *ReplayGitter) GetCommits(repo string) (commits []string) {
+	_ = rp.replay("GetCommits", &commits)
+	return
+}
+
+func (rp *ReplayGitter) GetTags(repo string) (tags []string) {
+	_ = rp.replay("GetTags", &tags)
+	return
+}
+
+func (rp *ReplayGitter) GetCurrentTreeHash(repo string) (hash string) {
+	_ = rp.replay("GetCurrentTreeHash", &hash)
+	return
+}
+
+func (rp *ReplayGitter) GetTreeHash(repo, tag string) (hash string) {
+	_ = rp.replay("GetTreeHash", &hash, tag)
+	return
+}
+
+func (rp *ReplayGitter) GetCommit(repo, rev string) (hash string) {
+	_ = rp.replay("GetCommit", &hash, rev)
+	return
+}
+
+func (rp *ReplayGitter) GetClosestTag(repo, commit string) (tag string) {
+	_ = rp.replay("GetClosestTag", &tag, commit)
+	return
+}
+
+func (rp *ReplayGitter) GetClosestTagMatch(repo, commit, match string) (tag string) {
+	_ = rp.replay("GetClosestTagMatch", &tag, commit, match)
+	return
+}
+
+func (rp *ReplayGitter) IsDirty(repo string) (dirty bool) {
+	_ = rp.replay("IsDirty", &dirty)
+	return
+}
+
+func (rp *ReplayGitter) GetBranch(repo string) (branch string) {
+	_ = rp.replay("GetBranch", &branch)
+	return
+}
+
+func (rp *ReplayGitter) GetBranchesFromTag(repo, tag string) (branches []string) {
+	_ = rp.replay("GetBranchesFromTag", &branches, tag)
+	return
+}
+
+func (rp *ReplayGitter) GetBuild(repo string) (build string) {
+	_ = rp.replay("GetBuild", &build)
+	return
+}
+
+func (rp *ReplayGitter) FetchTags(repo string) error {
+	return rp.replay("FetchTags", nil)
+}
+
+func (rp *ReplayGitter) FetchTagsWithOptions(repo string, opts FetchOptions) error {
+	return rp.replay("FetchTagsWithOptions", nil, opts.args()...)
+}
+
+func (rp *ReplayGitter) CheckAccess(repo string) error {
+	return rp.replay("CheckAccess", nil)
+}
+
+func (rp *ReplayGitter) IsShallow(repo string) (shallow bool) {
+	_ = rp.replay("IsShallow", &shallow)
+	return
+}
+
+func (rp *ReplayGitter) GetTagType(repo, tag string) (objtype string) {
+	_ = rp.replay("GetTagType", &objtype, tag)
+	return
+}
+
+func (rp *ReplayGitter) GetRemoteTags(repo, remote string) (tags []string, err error) {
+	err = rp.replay("GetRemoteTags", &tags, remote)
+	return
+}
@@ -0,0 +1,86 @@
+package makeversion
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_RecordingGitter_Replay(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo := makeTestRepo(t, 3, map[int]string{1: "av1.0.0", 2: "v1.1.0"})
+	env := MockEnvironment{"GITHUB_RUN_NUMBER": "12", "FORGEJO_TOKEN": "secret"}
+
+	rg := NewRecordingGitter(dg)
+	vs := &VersionStringer{Git: rg, Env: rg.Environment(env), Config: &Config{DirtyMarker: "dirty"}}
+	want, err := vs.GetVersion(repo)
+	is.NoErr(err)
+	is.Equal("v1.1.0-main.12", want.Version)
+	findings := vs.Doctor(repo)
+	fixture := rg.Fixture()
+	is.True(len(fixture.Calls) > 0)
+	is.Equal("12", *fixture.Env["GITHUB_RUN_NUMBER"])
+	val, ok := fixture.Env["FORGEJO_ACTIONS"]
+	is.True(ok && val == nil)
+	is.Equal("", *fixture.Env["FORGEJO_TOKEN"]) // secrets are recorded as set, but empty
+	is.True(rg.Environment(env).Getenv("HOME") == "")
+	_, ok = rg.Fixture().Env["HOME"]
+	is.True(!ok) // only CI variables are recorded
+
+	fileName := filepath.Join(t.TempDir(), "fixture.json")
+	is.NoErr(rg.Save(fileName))
+	rp, err := LoadReplayGitter(fileName)
+	is.NoErr(err)
+
+	vs.Git = rp
+	vs.Env = rp.Environment()
+	got, err := vs.GetVersion("/no/such/repo")
+	is.NoErr(err)
+	is.Equal(want, got)
+	is.Equal(findings, vs.Doctor("/no/such/repo"))
+	is.NoErr(rp.Err())
+
+	// calls that weren't recorded are reported
+	is.Equal("", rp.GetTreeHash(repo, "v9.9.9"))
+	is.True(rp.Err() != nil)
+	is.True(strings.Contains(rp.Err().Error(), "GetTreeHash(v9.9.9)"))
+	_, err = vs.GetVersion(repo)
+	is.NoErr(err) // only calls made by GetVersion are it's errors
+
+	vs.Git = NewReplayGitter(&GitterFixture{})
+	_, err = vs.GetVersion(repo)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "CheckGitRepo()"))
+}
+
+func Test_ReplayGitter_Sequence(t *testing.T) {
+	is := is.New(t)
+	rp := NewReplayGitter(&GitterFixture{Calls: []GitterCall{
+		{Method: "IsShallow", Result: []byte("true")},
+		{Method: "IsShallow", Result: []byte("false")},
+		{Method: "FetchTagsWithOptions", Args: FetchOptions{Unshallow: true}.args(), Error: "fatal: no remote"},
+	}})
+	is.True(rp.IsShallow("."))
+	is.True(!rp.IsShallow("."))
+	is.True(!rp.IsShallow("."))
+	err := rp.FetchTagsWithOptions(".", FetchOptions{Unshallow: true})
+	is.True(err != nil)
+	is.Equal("fatal: no remote", err.Error())
+	is.NoErr(rp.Err())
+}
+
+// Test_ReplayGitter_ShallowClone replays a fixture recorded in a depth 1
+// clone, where no tag is reachable and the commit count is wrong.
+func Test_ReplayGitter_ShallowClone(t *testing.T) {
+	is := is.New(t)
+	rp, err := LoadReplayGitter("testdata/replay/shallow-clone.json")
+	is.NoErr(err)
+	vs := &VersionStringer{Git: rp, Env: MockEnvironment{}}
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v0.0.0-main.1", vi.Version)
+}
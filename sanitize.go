@@ -0,0 +1,105 @@
+package makeversion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxBranchTextLength is the default maximum length of the branch text
+	// in versions. It is the longest allowed DNS label.
+	MaxBranchTextLength = 63
+	// MinBranchTextLength is the smallest allowed maximum length of the branch text.
+	MinBranchTextLength = 8
+	// MaxDockerTagLength is the longest allowed Docker tag.
+	MaxDockerTagLength = 128
+	// branchHashLength is the length of the hash added to truncated branch texts.
+	branchHashLength = 6
+)
+
+var reNotAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// transliterations are the ASCII spellings of common lowercase Latin letters.
+var transliterations = func() map[rune]string {
+	m := make(map[rune]string)
+	for ascii, letters := range map[string]string{
+		"a": "àáâãäåāăąǎ", "ae": "æ", "c": "çćĉċč", "d": "ďđð", "e": "èéêëēĕėęě",
+		"g": "ĝğġģ", "h": "ĥħ", "i": "ìíîïĩīĭįıǐ", "ij": "ĳ", "j": "ĵ", "k": "ķ",
+		"l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏőǒ", "oe": "œ", "r": "ŕŗř",
+		"s": "śŝşšșſ", "ss": "ß", "t": "ţťŧț", "th": "þ", "u": "ùúûüũūŭůűųǔ",
+		"w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+	} {
+		for _, r := range letters {
+			m[r] = ascii
+		}
+	}
+	return m
+}()
+
+// transliterate returns s with common Latin letters spelled in ASCII,
+// and combining marks removed.
+func transliterate(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if ascii, ok := transliterations[r]; ok {
+			sb.WriteString(ascii)
+		} else if !unicode.Is(unicode.Mn, r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// SanitizeBranch returns the branch name as a text that is valid as a semver
+// prerelease identifier, a Docker tag and a DNS label. It is the same as
+// SanitizeBranchLength with MaxBranchTextLength.
+func SanitizeBranch(name string) string {
+	return SanitizeBranchLength(name, MaxBranchTextLength)
+}
+
+// SanitizeBranchLength returns the branch name as a text that is valid as a
+// semver prerelease identifier and a Docker tag, and as a DNS label if
+// maxLength is at most 63:
+//
+//   - letters are lowercased, and common Latin letters transliterated to ASCII
+//   - runs of anything but ASCII letters and digits, including underscores
+//     and other non-ASCII letters, are replaced with a single dash
+//   - leading and trailing dashes are removed
+//   - a text longer than maxLength is cut, and ends with a dash and a short
+//     hash of the name, so that long names stay distinct
+//   - leading zeros are removed from an all-digit text
+//
+// The result is empty if the name has no letters or digits.
+func SanitizeBranchLength(name string, maxLength int) (text string) {
+	text = reNotAlnum.ReplaceAllString(transliterate(strings.ToLower(name)), "-")
+	text = strings.Trim(text, "-")
+	if len(text) > maxLength {
+		if maxLength > branchHashLength+1 {
+			sum := sha256.Sum256([]byte(name))
+			text = strings.TrimRight(text[:maxLength-branchHashLength-1], "-") + "-" + hex.EncodeToString(sum[:])[:branchHashLength]
+		} else {
+			text = strings.TrimRight(text[:maxLength], "-")
+		}
+	}
+	if text != "" && strings.Trim(text, "0123456789") == "" {
+		if text = strings.TrimLeft(text, "0"); text == "" {
+			text = "0"
+		}
+	}
+	return
+}
+
+// sanitizeBuild returns the build counter as dot separated identifiers
+// sanitized by SanitizeBranch, leaving out empty ones.
+func sanitizeBuild(build string) string {
+	var idents []string
+	for _, ident := range strings.Split(build, ".") {
+		if ident = SanitizeBranch(ident); ident != "" {
+			idents = append(idents, ident)
+		}
+	}
+	return strings.Join(idents, ".")
+}
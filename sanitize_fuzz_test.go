@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package makeversion
+
+import (
+	"testing"
+)
+
+func FuzzSanitizeBranch(f *testing.F) {
+	for _, name := range []string{"main", "Feature/ABC-123", "snake_case", "fix/ümlaut-ßtraße", "🎉", "0123", "a\xffb"} {
+		f.Add(name, uint8(0))
+	}
+	f.Fuzz(func(t *testing.T, name string, n uint8) {
+		maxLength := MinBranchTextLength + int(n)%(MaxDockerTagLength-MinBranchTextLength+1)
+		if err := checkBranchText(name, SanitizeBranchLength(name, maxLength), maxLength); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func FuzzGetVersion(f *testing.F) {
+	f.Add("main", "123")
+	f.Add("feature/x_y", "007")
+	f.Add("🎉", "1..2")
+	f.Fuzz(func(t *testing.T, branch, build string) {
+		if err := checkComposedVersion(branch, build); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package makeversion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/matryer/is"
+)
+
+var (
+	rePrereleaseIdent = regexp.MustCompile(`^(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)$`)
+	reDockerTag       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	reDNSLabel        = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+// checkBranchText returns an error if the text made by SanitizeBranchLength
+// isn't a valid prerelease identifier and Docker tag of at most maxLength
+// characters, and a DNS label if maxLength allows it.
+func checkBranchText(name, text string, maxLength int) error {
+	if text == "" {
+		return nil
+	}
+	res := map[string]*regexp.Regexp{
+		"prerelease identifier": rePrereleaseIdent,
+		"Docker tag":            reDockerTag,
+	}
+	if maxLength <= MaxBranchTextLength {
+		res["DNS label"] = reDNSLabel
+	}
+	for what, re := range res {
+		if !re.MatchString(text) {
+			return fmt.Errorf("SanitizeBranchLength(%q, %d) = %q, not a valid %s", name, maxLength, text, what)
+		}
+	}
+	if len(text) > maxLength {
+		return fmt.Errorf("SanitizeBranchLength(%q, %d) = %q, too long", name, maxLength, text)
+	}
+	if again := SanitizeBranchLength(text, maxLength); again != text {
+		return fmt.Errorf("SanitizeBranchLength(%q, %d) = %q, but sanitizing it again gives %q", name, maxLength, text, again)
+	}
+	return nil
+}
+
+// checkComposedVersion returns an error if the version made for
+// the branch name and build counter isn't a semantic version.
+func checkComposedVersion(branch, build string) error {
+	env := MockEnvironment{"CI_COMMIT_REF_NAME": branch, "CI_PIPELINE_IID": build}
+	vs := VersionStringer{Git: &MockGitter{}, Env: env}
+	vi, err := vs.GetVersion(".")
+	if err == nil {
+		if _, err = ParseSemver(vi.Version); err != nil {
+			err = fmt.Errorf("branch %q and build %q: %v", branch, build, err)
+		}
+	}
+	return err
+}
+
+func Test_SanitizeBranch(t *testing.T) {
+	is := is.New(t)
+	long := strings.Repeat("x", 100)
+	for name, want := range map[string]string{
+		"main":                         "main",
+		"Feature/ABC-123":              "feature-abc-123",
+		"snake_case_branch":            "snake-case-branch",
+		"branch.with..dots":            "branch-with-dots",
+		"--dashes--":                   "dashes",
+		"fix/ümlaut-ßtraße":            "fix-umlaut-sstrasse",
+		"FIX/ÜMLAUT":                   "fix-umlaut",
+		"u\u0308ber":                   "uber",
+		"Œuvre/Ångström/Łódź":          "oeuvre-angstrom-lodz",
+		"İstanbul":                     "istanbul",
+		"日本語/branch":                   "branch",
+		"🎉":                            "",
+		"":                             "",
+		"123":                          "123",
+		"0123":                         "123",
+		"000":                          "0",
+		"0123-fix":                     "0123-fix",
+		"release/1.2":                  "release-1-2",
+		"a\xffb":                       "a-b",
+		long:                           strings.Repeat("x", 56) + "-" + SanitizeBranch(long)[57:],
+		strings.Repeat("x", 55) + "/y": strings.Repeat("x", 55) + "-y",
+		strings.Repeat("0", 63):        "0",
+	} {
+		is.Equal(SanitizeBranch(name), want)
+		is.NoErr(checkBranchText(name, want, MaxBranchTextLength))
+	}
+}
+
+func Test_SanitizeBranchLength(t *testing.T) {
+	is := is.New(t)
+	long1 := "feature/" + strings.Repeat("a", 200) + "-one"
+	long2 := "feature/" + strings.Repeat("a", 200) + "-two"
+	text1 := SanitizeBranchLength(long1, 20)
+	text2 := SanitizeBranchLength(long2, 20)
+	is.Equal(len(text1), 20)
+	is.Equal(text1[:14], "feature-aaaaa-")
+	is.True(text1 != text2)                          // distinct names stay distinct
+	is.Equal(text1, SanitizeBranchLength(long1, 20)) // and the hash is stable
+	is.Equal(len(SanitizeBranchLength(long1, MaxDockerTagLength)), MaxDockerTagLength)
+
+	// dashes at the cut are removed before the hash is added
+	text := SanitizeBranchLength("abcdefghijkl-mnopqrstuvwxyz", 20)
+	is.Equal(text[:13], "abcdefghijkl-")
+	is.Equal(len(text), 19)
+	is.NoErr(checkBranchText("abcdefghijkl-mnopqrstuvwxyz", text, 20))
+}
+
+func Test_SanitizeBranch_Properties(t *testing.T) {
+	is := is.New(t)
+	is.NoErr(quick.Check(func(name string, n uint8) bool {
+		maxLength := MinBranchTextLength + int(n)%(MaxDockerTagLength-MinBranchTextLength+1)
+		err := checkBranchText(name, SanitizeBranchLength(name, maxLength), maxLength)
+		if err != nil {
+			t.Log(err)
+		}
+		return err == nil
+	}, &quick.Config{MaxCount: 10000}))
+}
+
+func Test_sanitizeBuild(t *testing.T) {
+	is := is.New(t)
+	is.Equal(sanitizeBuild("123"), "123")
+	is.Equal(sanitizeBuild("007"), "7")
+	is.Equal(sanitizeBuild("1.02"), "1.2")
+	is.Equal(sanitizeBuild("a_b..c."), "a-b.c")
+	is.Equal(sanitizeBuild("..."), "")
+}
+
+func Test_VersionStringer_GetVersion_Properties(t *testing.T) {
+	is := is.New(t)
+	is.NoErr(quick.Check(func(branch, build string) bool {
+		err := checkComposedVersion(branch, build)
+		if err != nil {
+			t.Log(err)
+		}
+		return err == nil
+	}, &quick.Config{MaxCount: 2000}))
+}
@@ -0,0 +1,51 @@
+package makeversion
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// reSemver matches a semantic version as defined by https://semver.org/,
+// with an optional leading "v".
+var reSemver = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// Semver is a parsed semantic version.
+type Semver struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string // prerelease identifiers, e.g. "mybranch.456"
+	Build string // build metadata, e.g. "dirty"
+}
+
+// ParseSemver parses a semantic version, with or without a leading "v".
+func ParseSemver(s string) (sv Semver, err error) {
+	if m := reSemver.FindStringSubmatch(s); m != nil {
+		if sv.Major, err = strconv.Atoi(m[1]); err == nil {
+			if sv.Minor, err = strconv.Atoi(m[2]); err == nil {
+				if sv.Patch, err = strconv.Atoi(m[3]); err == nil {
+					sv.Pre = m[4]
+					sv.Build = m[5]
+				}
+			}
+		}
+	} else {
+		err = fmt.Errorf("%q is not a semantic version", s)
+	}
+	return
+}
+
+// String returns the version with a leading "v", e.g. "v1.2.3-mybranch.456".
+func (sv Semver) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", sv.Major, sv.Minor, sv.Patch)
+	if sv.Pre != "" {
+		s += "-" + sv.Pre
+	}
+	if sv.Build != "" {
+		s += "+" + sv.Build
+	}
+	return s
+}
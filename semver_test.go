@@ -0,0 +1,25 @@
+package makeversion
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_ParseSemver(t *testing.T) {
+	is := is.New(t)
+
+	sv, err := ParseSemver("v1.2.3")
+	is.NoErr(err)
+	is.Equal(Semver{Major: 1, Minor: 2, Patch: 3}, sv)
+
+	sv, err = ParseSemver("10.20.30-mybranch.456+dirty")
+	is.NoErr(err)
+	is.Equal(Semver{Major: 10, Minor: 20, Patch: 30, Pre: "mybranch.456", Build: "dirty"}, sv)
+	is.Equal("v10.20.30-mybranch.456+dirty", sv.String())
+
+	for _, s := range []string{"", "v1", "v1.2", "1.2.3.4", "v01.2.3", "v1.2.3-", "v1.2.3-01", "v1.2.3-a..b", "v1.2.3+", "v1.2.3-a_b"} {
+		_, err = ParseSemver(s)
+		is.True(err != nil)
+	}
+}
@@ -0,0 +1,50 @@
+package makeversion
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// runGit runs git in the given directory, failing the test on errors.
+func runGit(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, b)
+	}
+	return string(b)
+}
+
+// makeTestRepo creates a repository with the given number of commits on "main".
+// Commit number N (counting from 1) is tagged with the tag in tags[N], if any.
+// Tags starting with "a" are created as annotated tags with the "a" removed.
+func makeTestRepo(t testing.TB, commits int, tags map[int]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	for i := 1; i <= commits; i++ {
+		fileName := filepath.Join(dir, "file.txt")
+		if err := os.WriteFile(fileName, []byte(strconv.Itoa(i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, dir, "add", "file.txt")
+		runGit(t, dir, "commit", "-q", "-m", "commit "+strconv.Itoa(i))
+		if tag := tags[i]; tag != "" {
+			if tag[0] == 'a' {
+				runGit(t, dir, "tag", "-a", "-m", tag[1:], tag[1:])
+			} else {
+				runGit(t, dir, "tag", tag)
+			}
+		}
+	}
+	return dir
+}
@@ -0,0 +1,289 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestUpdate is a manifest file with it's version fields set.
+type ManifestUpdate struct {
+	FileName string
+	Old      string // the current content
+	New      string // the content with the version fields set
+}
+
+// manifestEditor returns the content with the version fields set.
+type manifestEditor func(content string, vi *VersionInfo) (string, error)
+
+// manifestEditors are the editors for the supported manifest files, by base name.
+var manifestEditors = map[string]manifestEditor{
+	"package.json":   editPackageJSON,
+	"Chart.yaml":     editChartYAML,
+	"Cargo.toml":     editCargoTOML,
+	"pyproject.toml": editPyprojectTOML,
+	"VERSION":        editVersionFile,
+}
+
+// ManifestFiles returns the base names of the manifest files UpdateManifest supports.
+func ManifestFiles() (names []string) {
+	for name := range manifestEditors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+var errNoVersionField = errors.New("no version field found")
+
+// UpdateManifest reads the manifest file and returns it with the version fields set
+// from the VersionInfo, keeping the rest of the file as it is. The file type is given
+// by the base name of the file:
+//
+//   - package.json: "version", as for npm
+//   - Chart.yaml: "version", as for npm, and "appVersion", as is, if present
+//   - Cargo.toml: "version" in [package] or [workspace.package], as for npm
+//   - pyproject.toml: "version" in [project] or [tool.poetry], as PEP 440
+//   - VERSION: the whole file, as is
+func UpdateManifest(fileName string, vi *VersionInfo) (mu *ManifestUpdate, err error) {
+	editor, ok := manifestEditors[filepath.Base(fileName)]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown manifest file type", fileName)
+	}
+	var b []byte
+	if b, err = os.ReadFile(filepath.Clean(fileName)); err == nil /* #nosec G304 */ {
+		mu = &ManifestUpdate{FileName: fileName, Old: string(b)}
+		if mu.New, err = editor(mu.Old, vi); err != nil {
+			mu, err = nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+	}
+	return
+}
+
+// Changed returns true if the version fields didn't already match.
+func (mu *ManifestUpdate) Changed() bool {
+	return mu.Old != mu.New
+}
+
+// Diff returns the changes as a unified diff, or an empty string if there are none.
+func (mu *ManifestUpdate) Diff() string {
+	if !mu.Changed() {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", mu.FileName, mu.FileName)
+	oldLines, newLines := splitLines(mu.Old), splitLines(mu.New)
+	if len(oldLines) != len(newLines) {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(len(oldLines)), hunkRange(len(newLines)))
+		writeDiffLines(&sb, "-", oldLines)
+		writeDiffLines(&sb, "+", newLines)
+		return sb.String()
+	}
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			fmt.Fprintf(&sb, "@@ -%d +%d @@\n", i+1, i+1)
+			writeDiffLines(&sb, "-", oldLines[i:i+1])
+			writeDiffLines(&sb, "+", newLines[i:i+1])
+		}
+	}
+	return sb.String()
+}
+
+// splitLines splits the content after each newline.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkRange returns the range of a unified diff hunk covering n lines from the start.
+func hunkRange(n int) string {
+	switch n {
+	case 0:
+		return "0,0"
+	case 1:
+		return "1"
+	}
+	return "1," + strconv.Itoa(n)
+}
+
+func writeDiffLines(sb *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(prefix + line)
+		if !strings.HasSuffix(line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Write writes the updated content to the file, if it changed.
+func (mu *ManifestUpdate) Write() (err error) {
+	if mu.Changed() {
+		var fi os.FileInfo
+		if fi, err = os.Stat(mu.FileName); err == nil {
+			err = os.WriteFile(mu.FileName, []byte(mu.New), fi.Mode().Perm())
+		}
+	}
+	return
+}
+
+// editPackageJSON sets the top level "version" in a package.json file.
+func editPackageJSON(content string, vi *VersionInfo) (string, error) {
+	version, err := vi.Format(FormatNPM)
+	if err != nil {
+		return "", err
+	}
+	type frame struct{ object, key bool }
+	var stack []frame
+	dec := json.NewDecoder(strings.NewReader(content))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return "", errNoVersionField
+		}
+		if err != nil {
+			return "", err
+		}
+		if tok == json.Delim('}') || tok == json.Delim(']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		isKey := false
+		if top := len(stack) - 1; top >= 0 && stack[top].object {
+			isKey = stack[top].key
+			stack[top].key = !stack[top].key
+		}
+		switch {
+		case tok == json.Delim('{'):
+			stack = append(stack, frame{object: true, key: true})
+		case tok == json.Delim('['):
+			stack = append(stack, frame{})
+		case isKey && len(stack) == 1 && tok == "version":
+			start := int(dec.InputOffset())
+			if tok, err = dec.Token(); err != nil {
+				return "", err
+			}
+			if _, ok := tok.(string); !ok {
+				return "", errors.New(`"version" is not a string`)
+			}
+			end := int(dec.InputOffset())
+			start += strings.IndexByte(content[start:end], '"')
+			b, _ := json.Marshal(version)
+			return content[:start] + string(b) + content[end:], nil
+		}
+	}
+}
+
+var (
+	reYAMLVersion = regexp.MustCompile(`^(version|appVersion)(\s*:[ \t]*)("[^"]*"|'[^']*'|[^\s#]+)(.*)$`)
+	reTOMLTable   = regexp.MustCompile(`^\s*\[\[?\s*([^\]]*?)\s*\]\]?\s*(#.*)?$`)
+	reTOMLVersion = regexp.MustCompile(`^(\s*version\s*=\s*)("[^"]*"|'[^']*')(.*)$`)
+)
+
+// quoteLike returns the value quoted the same way as the old value.
+func quoteLike(old, value string) string {
+	switch {
+	case strings.HasPrefix(old, `"`):
+		return strconv.Quote(value)
+	case strings.HasPrefix(old, "'"):
+		return "'" + value + "'"
+	}
+	return value
+}
+
+// editLines replaces the version in each line for which edit returns ok.
+func editLines(content string, edit func(line string) (newLine string, ok bool)) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	found := false
+	for i, line := range lines {
+		eol := line[len(strings.TrimRight(line, "\r\n")):]
+		if newLine, ok := edit(strings.TrimRight(line, "\r\n")); ok {
+			lines[i] = newLine + eol
+			found = true
+		}
+	}
+	if !found {
+		return "", errNoVersionField
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// editChartYAML sets the top level "version" and "appVersion" in a Helm Chart.yaml file.
+func editChartYAML(content string, vi *VersionInfo) (string, error) {
+	version, err := vi.Format(FormatNPM)
+	if err != nil {
+		return "", err
+	}
+	foundVersion := false
+	content, err = editLines(content, func(line string) (string, bool) {
+		m := reYAMLVersion.FindStringSubmatch(line)
+		if m == nil {
+			return "", false
+		}
+		value := vi.Version
+		if m[1] == "version" {
+			value = version
+			foundVersion = true
+		}
+		return m[1] + m[2] + quoteLike(m[3], value) + m[4], true
+	})
+	if err == nil && !foundVersion {
+		err = errNoVersionField
+	}
+	return content, err
+}
+
+// editTOML sets "version" in the given tables of a TOML file.
+func editTOML(content, version string, tables ...string) (string, error) {
+	table := ""
+	return editLines(content, func(line string) (string, bool) {
+		if m := reTOMLTable.FindStringSubmatch(line); m != nil {
+			table = m[1]
+			return "", false
+		}
+		for _, t := range tables {
+			if t == table {
+				if m := reTOMLVersion.FindStringSubmatch(line); m != nil {
+					return m[1] + quoteLike(m[2], version) + m[3], true
+				}
+			}
+		}
+		return "", false
+	})
+}
+
+// editCargoTOML sets the package version in a Cargo.toml file.
+func editCargoTOML(content string, vi *VersionInfo) (string, error) {
+	version, err := vi.Format(FormatNPM)
+	if err != nil {
+		return "", err
+	}
+	return editTOML(content, version, "package", "workspace.package")
+}
+
+// editPyprojectTOML sets the project version in a pyproject.toml file.
+func editPyprojectTOML(content string, vi *VersionInfo) (string, error) {
+	version, err := vi.Format(FormatPEP440)
+	if err != nil {
+		return "", err
+	}
+	return editTOML(content, version, "project", "tool.poetry")
+}
+
+// editVersionFile replaces the content of a VERSION file, keeping a trailing newline.
+func editVersionFile(content string, vi *VersionInfo) (string, error) {
+	eol := content[len(strings.TrimRight(content, "\r\n")):]
+	if eol == "" {
+		eol = "\n"
+	}
+	return vi.Version + eol, nil
+}
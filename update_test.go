@@ -0,0 +1,112 @@
+package makeversion
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// writeTestManifest writes the content to a file with the given base name in a new directory.
+func writeTestManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func Test_UpdateManifest(t *testing.T) {
+	is := is.New(t)
+	vi := &VersionInfo{Version: "v1.2.3-feature.45"}
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{
+			"package.json",
+			"{\n  \"name\": \"x\",\n  \"config\": {\"version\": \"9\"},\n  \"files\": [{\"version\": 1}],\n  \"version\" :  \"0.0.1\",\n  \"x\": 1\n}\n",
+			"{\n  \"name\": \"x\",\n  \"config\": {\"version\": \"9\"},\n  \"files\": [{\"version\": 1}],\n  \"version\" :  \"1.2.3-feature.45\",\n  \"x\": 1\n}\n",
+		},
+		{
+			"Chart.yaml",
+			"apiVersion: v2\nname: x\n# version: 0.0.0\nversion: 0.1.0 # the chart\ndependencies:\n  - name: y\n    version: 1.0.0\nappVersion: '0.1'\r\n",
+			"apiVersion: v2\nname: x\n# version: 0.0.0\nversion: 1.2.3-feature.45 # the chart\ndependencies:\n  - name: y\n    version: 1.0.0\nappVersion: 'v1.2.3-feature.45'\r\n",
+		},
+		{
+			"Cargo.toml",
+			"[package]\nname = \"x\"\nversion = \"0.1.0\" # keep this\n\n[dependencies]\nserde = { version = \"1\" }\n[dependencies.rand]\nversion = \"0.8\"\n",
+			"[package]\nname = \"x\"\nversion = \"1.2.3-feature.45\" # keep this\n\n[dependencies]\nserde = { version = \"1\" }\n[dependencies.rand]\nversion = \"0.8\"\n",
+		},
+		{
+			"Cargo.toml",
+			"[workspace]\nmembers = [\"a\"]\n\n[ workspace.package ]\nversion = '0.1.0'\n",
+			"[workspace]\nmembers = [\"a\"]\n\n[ workspace.package ]\nversion = '1.2.3-feature.45'\n",
+		},
+		{
+			"pyproject.toml",
+			"[build-system]\nrequires = [\"hatchling\"]\n\n[project]\nname = \"x\"\nversion = \"0.1\"\n",
+			"[build-system]\nrequires = [\"hatchling\"]\n\n[project]\nname = \"x\"\nversion = \"1.2.3.dev45+feature\"\n",
+		},
+		{
+			"pyproject.toml",
+			"[tool.poetry]\nname = \"x\"\nversion = \"0.1\"\n",
+			"[tool.poetry]\nname = \"x\"\nversion = \"1.2.3.dev45+feature\"\n",
+		},
+		{"VERSION", "v0.0.0\n", "v1.2.3-feature.45\n"},
+		{"VERSION", "", "v1.2.3-feature.45\n"},
+		{"VERSION", "v0.0.0\r\n", "v1.2.3-feature.45\r\n"},
+	} {
+		fileName := writeTestManifest(t, tc.name, tc.content)
+		mu, err := UpdateManifest(fileName, vi)
+		is.NoErr(err)
+		is.Equal(tc.want, mu.New) // updated content
+		is.True(mu.Changed())
+
+		is.NoErr(mu.Write())
+		mu, err = UpdateManifest(fileName, vi)
+		is.NoErr(err)
+		is.True(!mu.Changed())
+		is.Equal("", mu.Diff())
+	}
+}
+
+func Test_UpdateManifest_Errors(t *testing.T) {
+	is := is.New(t)
+	vi := &VersionInfo{Version: "v1.2.3"}
+	for name, content := range map[string]string{
+		"package.json":   `{"name": "x", "config": {"version": "1"}}`,
+		"Chart.yaml":     "name: x\nappVersion: v1\n",
+		"Cargo.toml":     "[package]\nversion.workspace = true\n",
+		"pyproject.toml": "[project]\ndynamic = [\"version\"]\n",
+	} {
+		_, err := UpdateManifest(writeTestManifest(t, name, content), vi)
+		is.True(err != nil) // no version field
+	}
+
+	_, err := UpdateManifest(writeTestManifest(t, "package.json", `{"version": 1}`), vi)
+	is.True(err != nil)
+	_, err = UpdateManifest(writeTestManifest(t, "package.json", `{"version": `), vi)
+	is.True(err != nil)
+	_, err = UpdateManifest(writeTestManifest(t, "setup.py", ""), vi)
+	is.True(err != nil)
+	_, err = UpdateManifest(filepath.Join(t.TempDir(), "VERSION"), vi)
+	is.True(os.IsNotExist(err))
+
+	vi.Version = "v1"
+	_, err = UpdateManifest(writeTestManifest(t, "Cargo.toml", "[package]\nversion = \"0.1.0\"\n"), vi)
+	is.True(err != nil) // not semver
+}
+
+func Test_ManifestUpdate_Diff(t *testing.T) {
+	is := is.New(t)
+	mu := &ManifestUpdate{FileName: "Chart.yaml", Old: "name: x\nversion: 0.1.0\n", New: "name: x\nversion: 1.2.3\n"}
+	is.Equal("--- Chart.yaml\n+++ Chart.yaml\n@@ -2 +2 @@\n-version: 0.1.0\n+version: 1.2.3\n", mu.Diff())
+
+	mu = &ManifestUpdate{FileName: "VERSION", Old: "v1", New: "v2\n"}
+	is.Equal("--- VERSION\n+++ VERSION\n@@ -1 +1 @@\n-v1\n\\ No newline at end of file\n+v2\n", mu.Diff())
+
+	mu = &ManifestUpdate{FileName: "VERSION", Old: "", New: "v2\n"}
+	is.Equal("--- VERSION\n+++ VERSION\n@@ -0,0 +1 @@\n+v2\n", mu.Diff())
+}
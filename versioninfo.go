@@ -7,14 +7,50 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
 type VersionInfo struct {
-	Tag     string // git tag, e.g. "v1.2.3"
-	Branch  string // git branch, e.g. "mybranch"
-	Build   string // git or CI build number, e.g. "456"
-	Version string // composite version, e.g. "v1.2.3-mybranch.456"
+	Tag         string // git tag, e.g. "v1.2.3"
+	Branch      string // git branch, e.g. "mybranch"
+	Build       string // git or CI build number, e.g. "456"
+	PullRequest string // pull or merge request number, e.g. "123", or empty if not a pull request build
+	Version     string // composite version, e.g. "v1.2.3-mybranch.456"
+	Release     bool   // true if the version is the tag, built on a release branch
+}
+
+// TemplateData is the data version templates are executed with.
+// While the template executes, Version holds the version taken
+// from the tag.
+type TemplateData struct {
+	VersionInfo
+	BranchText string // branch name made suitable for a version, e.g. "mybranch"
+	Suffix     string // BranchText and Build joined by a dot, e.g. "mybranch.456"
+	Dirty      string // the dirty marker if the tree has uncommitted changes, otherwise empty
+}
+
+func executeTemplate(tmplText string, data interface{}) (result string, err error) {
+	var tmpl *template.Template
+	if tmpl, err = template.New("version").Parse(tmplText); err == nil {
+		var sb strings.Builder
+		if err = tmpl.Execute(&sb, data); err == nil {
+			result = sb.String()
+		}
+	}
+	return
+}
+
+// Execute returns the result of executing the text/template
+// given in tmplText with the VersionInfo as data.
+func (vi *VersionInfo) Execute(tmplText string) (string, error) {
+	return executeTemplate(tmplText, vi)
+}
+
+// Execute returns the result of executing the text/template
+// given in tmplText with the TemplateData as data.
+func (td *TemplateData) Execute(tmplText string) (string, error) {
+	return executeTemplate(tmplText, td)
 }
 
 // Render returns either the Version string followed by a newline,
@@ -26,3 +26,46 @@ func Test_VersionInfo_Render(t *testing.T) {
 	is.True(err != nil)
 	is.Equal(txt, "")
 }
+
+func Test_VersionInfo_Execute(t *testing.T) {
+	is := is.New(t)
+	vi := &VersionInfo{Tag: "v1.2.3", Build: "45", PullRequest: "123", Version: "v1.2.3"}
+
+	txt, err := vi.Execute(DefaultPullRequestTemplate)
+	is.NoErr(err)
+	is.Equal("v1.2.3-pr.123.45", txt)
+
+	vi.Build = ""
+	txt, err = vi.Execute(DefaultPullRequestTemplate)
+	is.NoErr(err)
+	is.Equal("v1.2.3-pr.123", txt)
+
+	_, err = vi.Execute("{{.Tag")
+	is.True(err != nil)
+
+	_, err = vi.Execute("{{.NoSuchField}}")
+	is.True(err != nil)
+}
+
+func Test_TemplateData_Execute(t *testing.T) {
+	is := is.New(t)
+	td := &TemplateData{
+		VersionInfo: VersionInfo{Tag: "myapp/v1.2.3", Version: "v1.2.3", Build: "45"},
+		BranchText:  "mybranch",
+		Suffix:      "mybranch.45",
+	}
+
+	txt, err := td.Execute(DefaultTemplate)
+	is.NoErr(err)
+	is.Equal("v1.2.3-mybranch.45", txt)
+
+	td.Dirty = "dirty"
+	txt, err = td.Execute(DefaultTemplate)
+	is.NoErr(err)
+	is.Equal("v1.2.3-mybranch.45+dirty", txt)
+
+	td.Suffix = ""
+	txt, err = td.Execute(DefaultTemplate)
+	is.NoErr(err)
+	is.Equal("v1.2.3+dirty", txt)
+}
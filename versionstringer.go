@@ -3,18 +3,50 @@
 package makeversion
 
 import (
+	"fmt"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
-var (
-	// reCheckTag  = regexp.MustCompile(`^v\d+(\.\d+(\.\d+)?)?$`)
-	reOnlyWords = regexp.MustCompile(`[^\w]`)
-)
+// var reCheckTag = regexp.MustCompile(`^v\d+(\.\d+(\.\d+)?)?$`)
+
+// defaultBranchEnvVars are the environment variables CI systems
+// use to tell us the name of the repository default branch.
+var defaultBranchEnvVars = []string{
+	"CI_DEFAULT_BRANCH",                 // GitLab
+	"BUILDKITE_PIPELINE_DEFAULT_BRANCH", // Buildkite
+	"CI_REPO_DEFAULT_BRANCH",            // Woodpecker
+	"DRONE_REPO_BRANCH",                 // Drone
+}
+
+// tagEnvVars are the environment variables CI systems use to
+// give us the tag being built.
+var tagEnvVars = []string{
+	"CI_COMMIT_TAG", // GitLab and Woodpecker
+	"BUILDKITE_TAG", // Buildkite
+	"CIRCLE_TAG",    // CircleCI
+	"DRONE_TAG",     // Drone
+}
+
+// buildEnvVars are the environment variables CI systems use to
+// give us the build counter.
+var buildEnvVars = []string{
+	"CI_PIPELINE_IID",        // GitLab
+	"GITHUB_RUN_NUMBER",      // GitHub
+	"BUILDKITE_BUILD_NUMBER", // Buildkite
+	"CIRCLE_BUILD_NUM",       // CircleCI
+	"CI_PIPELINE_NUMBER",     // Woodpecker
+	"DRONE_BUILD_NUMBER",     // Drone
+}
 
 type VersionStringer struct {
-	Git Gitter      // Git
-	Env Environment // environment
+	Git     Gitter       // Git
+	Env     Environment  // environment
+	Config  *Config      // versioning policy, nil for the defaults
+	Explain *Explanation // if not nil, decisions are recorded here
+	event   *gitHubEvent // the event payload last read by GetGitHubEvent
 }
 
 // NewVersionStringer returns a VersionStringer ready to examine
@@ -30,155 +62,442 @@ func NewVersionStringer(gitBin string) (vs *VersionStringer, err error) {
 	return
 }
 
+// NewVersionStringerWithConfig returns a VersionStringer like NewVersionStringer,
+// using the policy in the given configuration file. If configFile is empty,
+// we look for a DefaultConfigFile in the repository containing repoDir and it's
+// parent directories, and use the defaults if none is found.
+func NewVersionStringerWithConfig(gitBin, repoDir, configFile string) (vs *VersionStringer, err error) {
+	if vs, err = NewVersionStringer(gitBin); err == nil {
+		if configFile == "" {
+			if repo, e := vs.Git.CheckGitRepo(repoDir); e == nil {
+				repoDir = repo
+			}
+			configFile = FindConfig(repoDir)
+		}
+		if configFile != "" {
+			if vs.Config, err = LoadConfig(configFile); err != nil {
+				vs = nil
+			}
+		}
+	}
+	return
+}
+
+// GetConfig returns the versioning policy in effect, with the
+// overrides for the current CI system applied.
+func (vs *VersionStringer) GetConfig() Config {
+	return vs.Config.Resolve(DetectCI(vs.Env))
+}
+
 // IsEnvTrue returns true if the given environment variable
 // exists and is set to the string "true" (not case sensitive).
 func (vs *VersionStringer) IsEnvTrue(envvar string) bool {
-	return strings.ToLower(strings.TrimSpace(vs.Env.Getenv(envvar))) == "true"
+	return strings.ToLower(vs.getenv(envvar)) == "true"
 }
 
-// IsReleaseBranch returns true if the given branch name should
-// be allowed to use 'release mode', where the version string
-// doesn't contains build information suffix.
-func (vs *VersionStringer) IsReleaseBranch(branchName string) bool {
+// ReleaseMatch explains the decision made by MatchReleaseBranch.
+type ReleaseMatch struct {
+	Release bool   // true if the branch is allowed to use release mode
+	Pattern string // the configured release branch pattern the branch matched, if any
+	Channel string // the channel of the matched pattern, if any
+	Reason  string // why the decision was made
+}
+
+// getDefaultBranch returns the default branch name if
+// the CI system tells us what it is.
+func (vs *VersionStringer) getDefaultBranch() (string, bool) {
+	// GitHub, Gitea and Forgejo give us the default branch
+	// name in the event payload.
+	if ev := vs.GetGitHubEvent(); ev != nil && ev.Repository.DefaultBranch != "" {
+		return ev.Repository.DefaultBranch, true
+	}
+	// GitLab, Buildkite, Drone and Woodpecker give us the default branch name directly.
+	for _, envvar := range defaultBranchEnvVars {
+		if defBranch, ok := vs.lookupEnv(envvar); ok {
+			return strings.TrimSpace(defBranch), true
+		}
+	}
+	return "", false
+}
+
+// MatchReleaseBranch decides if the given branch name should be allowed
+// to use 'release mode', and returns the configured release branch
+// pattern it matched along with that pattern's channel.
+func (vs *VersionStringer) MatchReleaseBranch(branchName string) (m ReleaseMatch) {
+	m = vs.matchReleaseBranch(branchName)
+	vs.explain(ExplainRelease, branchName, strconv.FormatBool(m.Release), m.Reason)
+	return
+}
+
+func (vs *VersionStringer) matchReleaseBranch(branchName string) (m ReleaseMatch) {
+	cfg := vs.GetConfig()
+	for _, rb := range cfg.ReleaseBranches {
+		if rb.Match(branchName) {
+			m.Pattern = rb.String()
+			m.Channel = rb.Channel
+			break
+		}
+	}
+
 	// A GitLab or GitHub protected branch allows release mode.
 	if vs.IsEnvTrue("CI_COMMIT_REF_PROTECTED") || vs.IsEnvTrue("GITHUB_REF_PROTECTED") {
-		return true
+		m.Release, m.Reason = true, "the branch is protected"
+		return
+	}
+
+	// So does a branch matching a configured pattern.
+	if m.Pattern != "" {
+		m.Release, m.Reason = true, fmt.Sprintf("the branch matches release branch pattern %q", m.Pattern)
+		return
 	}
 
-	// If the branch isn't protected, we only allow release
-	// mode for the 'default' branch.
+	// Otherwise we only allow release mode for the 'default' branch.
+	if defBranch, ok := vs.getDefaultBranch(); ok {
+		if m.Release = branchName == defBranch; m.Release {
+			m.Reason = "the branch is the default branch"
+		} else {
+			m.Reason = fmt.Sprintf("the branch is not the default branch %q", defBranch)
+		}
+		return
+	}
 
-	// GitLab gives us the default branch name directly.
-	if defBranch, ok := vs.Env.LookupEnv("CI_DEFAULT_BRANCH"); ok {
-		defBranch = strings.TrimSpace(defBranch)
-		return branchName == defBranch
+	// A detached HEAD allows release mode.
+	if branchName == "" {
+		m.Release, m.Reason = true, "HEAD is detached"
+		return
 	}
 
 	// Fallback to common default branch names.
-	switch branchName {
-	case "": // this is the case for a detached HEAD
-		return true
-	case "default":
-		return true
-	case "master":
-		return true
-	case "main":
-		return true
+	for _, rb := range DefaultReleaseBranches {
+		if rb.Match(branchName) {
+			m.Release, m.Reason = true, fmt.Sprintf("the branch is named %q", branchName)
+			return
+		}
 	}
 
-	return false
+	m.Reason = "the branch is not a release branch"
+	return
+}
+
+// IsReleaseBranch returns true if the given branch name should
+// be allowed to use 'release mode', where the version string
+// doesn't contains build information suffix.
+func (vs *VersionStringer) IsReleaseBranch(branchName string) bool {
+	return vs.MatchReleaseBranch(branchName).Release
 }
 
 // GetTag returns the semver git version tag matching the current tree, or
 // the latest semver tag if none match.
+//
+// A tag given by the CI system or on the current tree is only checked against
+// the tag pattern if the configuration sets tagPattern or tagPrefix.
+//
+// On a maintenance branch only tags for that major and minor version are considered.
 func (vs *VersionStringer) GetTag(repo string) (string, bool) {
-	if tag := strings.TrimSpace(vs.Env.Getenv("CI_COMMIT_TAG")); tag != "" {
-		return tag, true
+	cfg := vs.GetConfig()
+	match := cfg.TagPattern
+	// Tags given by the CI system or on the current tree are only
+	// filtered if the configuration asks for it.
+	filter := vs.Config.setsTagPattern(DetectCI(vs.Env))
+	if cfg.MaintenanceBranch != "" {
+		_, branchName := vs.GetBranch(repo)
+		if major, minor, ok := vs.GetMaintenanceLine(branchName); ok {
+			match = fmt.Sprintf("%s%d.%d.*", escapeGlob(cfg.TagPrefix), major, minor)
+			filter = true
+			vs.explain(ExplainTag, "", match, "maintenance branch %q restricts tags", branchName)
+		}
+	}
+	isMatch := func(tag string) bool {
+		ok1, _ := path.Match(cfg.TagPattern, tag)
+		ok2, _ := path.Match(match, tag)
+		return ok1 && ok2
+	}
+	for _, envvar := range tagEnvVars {
+		if tag := vs.getenv(envvar); tag != "" {
+			if ok, _ := path.Match(cfg.TagPattern, tag); ok || !filter {
+				vs.explain(ExplainTag, tag, "", "given by %s", envvar)
+				return tag, true
+			}
+			vs.explain(ExplainTag, tag, "", "given by %s, but doesn't match %q", envvar, cfg.TagPattern)
+		}
 	}
 	if repo, err := vs.Git.CheckGitRepo(repo); err == nil {
 		if currtreehash := vs.Git.GetCurrentTreeHash(repo); currtreehash != "" {
+			vs.explain(ExplainTree, "current", currtreehash, "")
 			for _, testtag := range vs.Git.GetTags(repo) {
-				if vs.Git.GetTreeHash(repo, testtag) == currtreehash {
+				if filter && !isMatch(testtag) {
+					vs.explain(ExplainTag, testtag, "", "doesn't match %q", match)
+					continue
+				}
+				treehash := vs.Git.GetTreeHash(repo, testtag)
+				if treehash == currtreehash {
+					vs.explain(ExplainTag, testtag, treehash, "same tree as current")
 					return testtag, true
 				}
+				vs.explain(ExplainTag, testtag, treehash, "different tree")
 			}
 		}
-		if tag := vs.Git.GetClosestTag(repo, "HEAD"); tag != "" {
+		if tag := closestTag(vs.Git, repo, "HEAD", match); isMatch(tag) {
+			vs.explain(ExplainTag, tag, "", "closest tag matching %q reachable from HEAD", match)
 			return tag, false
 		}
+	} else {
+		vs.explain(ExplainTag, "", "", "not a git repository: %v", err)
 	}
-	return "v0.0.0", false
+	vs.explain(ExplainTag, cfg.Fallback, "", "no tag found, using fallback")
+	return cfg.Fallback, false
 }
 
-func (vs *VersionStringer) getBranchGitHub(repo string) (branchName string) {
-	if branchName = strings.TrimSpace(vs.Env.Getenv("GITHUB_REF_NAME")); branchName != "" {
-		if strings.TrimSpace(vs.Env.Getenv("GITHUB_REF_TYPE")) == "tag" {
-			for _, branchName = range vs.Git.GetBranchesFromTag(repo, branchName) {
-				if vs.IsReleaseBranch(branchName) {
-					break
-				}
+// GetMaintenanceLine returns the major and minor version that builds from
+// the given branch are restricted to, if it is a maintenance branch.
+func (vs *VersionStringer) GetMaintenanceLine(branchName string) (major, minor int, ok bool) {
+	if pattern := vs.GetConfig().MaintenanceBranch; pattern != "" {
+		if re, err := regexp.Compile(pattern); err == nil {
+			if m := re.FindStringSubmatch(branchName); len(m) > 2 {
+				var err1, err2 error
+				major, err1 = strconv.Atoi(m[1])
+				minor, err2 = strconv.Atoi(m[2])
+				ok = err1 == nil && err2 == nil
 			}
 		}
 	}
 	return
 }
 
+// escapeGlob escapes the characters that are special in glob patterns.
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// checkMaintenanceLine returns an error if the version in the tag
+// doesn't belong to the maintenance line of the branch.
+func (vs *VersionStringer) checkMaintenanceLine(branchName, tag string) (err error) {
+	if major, minor, ok := vs.GetMaintenanceLine(branchName); ok {
+		version := strings.TrimPrefix(tag, vs.GetConfig().TagPrefix)
+		if sv, e := ParseSemver(version); e != nil || sv.Major != major || sv.Minor != minor {
+			err = fmt.Errorf("maintenance branch %q requires a %d.%d.x version, but the tag is %q (is there a %d.%d tag reachable from HEAD?)",
+				branchName, major, minor, tag, major, minor)
+		}
+	}
+	return
+}
+
+// IsDirty returns true if the working tree has uncommitted changes to tracked files.
+// If the Gitter isn't a DirtyChecker, only staged changes are seen.
+func (vs *VersionStringer) IsDirty(repo string) bool {
+	if repo, err := vs.Git.CheckGitRepo(repo); err == nil {
+		return isDirty(vs.Git, repo)
+	}
+	return false
+}
+
+// getBranchFromTag returns the first release branch containing the tag,
+// the last branch found if none of them are release branches, or the
+// tag itself if no branch contains it, as in shallow clones.
+func (vs *VersionStringer) getBranchFromTag(repo, tag string) (branchName string) {
+	branchName = tag
+	for _, branchName = range vs.Git.GetBranchesFromTag(repo, tag) {
+		if vs.IsReleaseBranch(branchName) {
+			break
+		}
+	}
+	return
+}
+
+func (vs *VersionStringer) getBranchGitHub(repo string) (branchName string) {
+	if branchName = vs.getenv("GITHUB_REF_NAME"); branchName != "" {
+		if vs.getenv("GITHUB_REF_TYPE") == "tag" {
+			branchName = vs.getBranchFromTag(repo, branchName)
+		}
+	}
+	return
+}
+
 func (vs *VersionStringer) getBranchGitLab(repo string) (branchName string) {
-	if branchName = strings.TrimSpace(vs.Env.Getenv("CI_COMMIT_REF_NAME")); branchName != "" {
-		if strings.TrimSpace(vs.Env.Getenv("CI_COMMIT_TAG")) == branchName {
-			for _, branchName = range vs.Git.GetBranchesFromTag(repo, branchName) {
-				if vs.IsReleaseBranch(branchName) {
-					break
-				}
-			}
+	if branchName = vs.getenv("CI_COMMIT_REF_NAME"); branchName != "" {
+		if vs.getenv("CI_COMMIT_TAG") == branchName {
+			branchName = vs.getBranchFromTag(repo, branchName)
 		}
 	}
 	return
 }
 
+// getBranchTagged handles CI systems that give us the branch and
+// tag in separate variables, leaving the branch empty or set to
+// the tag name for tag builds.
+func (vs *VersionStringer) getBranchTagged(repo, branchVar, tagVar string) (branchName string) {
+	if tag := vs.getenv(tagVar); tag != "" {
+		return vs.getBranchFromTag(repo, tag)
+	}
+	return vs.getenv(branchVar)
+}
+
+func (vs *VersionStringer) getBranchBuildkite(repo string) string {
+	return vs.getBranchTagged(repo, "BUILDKITE_BRANCH", "BUILDKITE_TAG")
+}
+
+func (vs *VersionStringer) getBranchCircleCI(repo string) string {
+	return vs.getBranchTagged(repo, "CIRCLE_BRANCH", "CIRCLE_TAG")
+}
+
+func (vs *VersionStringer) getBranchDrone(repo string) string {
+	return vs.getBranchTagged(repo, "DRONE_BRANCH", "DRONE_TAG")
+}
+
 // GetBranch returns the current branch as a string suitable
-// for inclusion in the semver text as well as the actual
-// branch name in the build system or Git. If no branch name
-// can be found, then "HEAD" is returned if we are running within
-// a Git repo, or an empty string if we're not.
+// for inclusion in the semver text, as made by SanitizeBranchLength,
+// as well as the actual branch name in the build system or Git.
+// If no branch name can be found, then "HEAD" is returned if we
+// are running within a Git repo, or an empty string if we're not.
 func (vs *VersionStringer) GetBranch(repo string) (branchText, branchName string) {
-	if branchName = vs.getBranchGitHub(repo); branchName == "" {
-		if branchName = vs.getBranchGitLab(repo); branchName == "" {
-			branchName = vs.Git.GetBranch(repo)
+	for _, getBranch := range []func(string) string{
+		vs.getBranchGitHub,
+		vs.getBranchGitLab,
+		vs.getBranchBuildkite,
+		vs.getBranchCircleCI,
+		vs.getBranchDrone,
+		vs.Git.GetBranch,
+	} {
+		if branchName = getBranch(repo); branchName != "" {
+			break
 		}
 	}
+	vs.explain(ExplainBranch, "name", branchName, "")
 	branchText = branchName
-	if branchText != "" {
-		branchText = reOnlyWords.ReplaceAllString(branchText, "-")
-		for {
-			if newBranchText := strings.ReplaceAll(branchText, "--", "-"); newBranchText != branchText {
-				branchText = newBranchText
-				continue
+	if pr := vs.GetPullRequest(); pr != "" {
+		// GitHub gives us "123/merge" as the branch name for pull requests.
+		branchText = "pr-" + pr
+	}
+	branchText = SanitizeBranchLength(branchText, vs.GetConfig().MaxBranchLength)
+	vs.explain(ExplainBranch, "text", branchText, "")
+	return
+}
+
+// GetPullRequest returns the pull or merge request number if this
+// is a pull request build, otherwise an empty string.
+func (vs *VersionStringer) GetPullRequest() (pr string) {
+	if pr = vs.getenv("CI_MERGE_REQUEST_IID"); pr == "" {
+		eventName := vs.getenv("GITHUB_EVENT_NAME")
+		isPullRequest := strings.HasPrefix(eventName, "pull_request")
+		if isPullRequest || eventName == "" {
+			if ev := vs.GetGitHubEvent(); ev != nil && ev.IsPullRequest() {
+				pr = strconv.Itoa(ev.PullRequest.Number)
+			} else if isPullRequest {
+				// GITHUB_REF_NAME is "123/merge" for pull requests.
+				refName := vs.getenv("GITHUB_REF_NAME")
+				if num, err := strconv.Atoi(strings.Split(refName, "/")[0]); err == nil && num > 0 {
+					pr = strconv.Itoa(num)
+				}
 			}
-			break
 		}
-		branchText = strings.TrimPrefix(branchText, "-")
-		branchText = strings.TrimSuffix(branchText, "-")
-		branchText = strings.ToLower(branchText)
 	}
-
 	return
 }
 
 // GetBuild returns the build counter. This is taken from the CI system if available,
 // otherwise the Git commit count is used. Returns an empty string if no reasonable build
-// counter can be found.
+// counter can be found. Build counters from the CI system are sanitized like branch names.
+//
+// Note that Gitea and Forgejo set GITHUB_RUN_NUMBER to a counter
+// shared by all workflows in the repository, so it will have gaps.
 func (vs *VersionStringer) GetBuild(repo string) (build string) {
-	if build = strings.TrimSpace(vs.Env.Getenv("CI_PIPELINE_IID")); build == "" {
-		if build = strings.TrimSpace(vs.Env.Getenv("GITHUB_RUN_NUMBER")); build == "" {
-			build = vs.Git.GetBuild(repo)
+	for _, envvar := range buildEnvVars {
+		if build = vs.getenv(envvar); build != "" {
+			build = sanitizeBuild(build)
+			vs.explain(ExplainBuild, "", build, "given by %s", envvar)
+			return
 		}
 	}
+	build = vs.Git.GetBuild(repo)
+	vs.explain(ExplainBuild, "", build, "commit count")
 	return
 }
 
 // GetVersion returns a version string for the source code in the Git repository.
+//
+// The version is the tag, with the configured tag prefix replaced by "v",
+// optionally followed by a suffix made from the branch and build. The
+// configured templates decide the final layout.
+//
+// Returns an error if the configuration is invalid, or if git couldn't run,
+// e.g. because it timed out.
 func (vs *VersionStringer) GetVersion(repo string) (vi VersionInfo, err error) {
+	if err = vs.Config.Validate(); err != nil {
+		return
+	}
+	er, ok := vs.Git.(ErrorRecorder)
+	if !ok {
+		return vs.getVersion(repo)
+	}
+	var gitErr error
+	scoped := *vs
+	scoped.Git = er.RecordErrors(&gitErr)
+	vi, err = scoped.getVersion(repo)
+	vs.event = scoped.event
+	if err == nil {
+		err = gitErr
+	}
+	return
+}
+
+func (vs *VersionStringer) getVersion(repo string) (vi VersionInfo, err error) {
 	var sametree bool
+	if ci := DetectCI(vs.Env); ci != CINone {
+		vs.explain(ExplainCI, "", string(ci), "")
+	} else {
+		vs.explain(ExplainCI, "", "", "no CI system detected")
+	}
+	cfg := vs.GetConfig()
 	if vi.Tag, sametree = vs.GetTag(repo); vi.Tag != "" {
 		vi.Version = vi.Tag
+		if cfg.TagPrefix != DefaultTagPrefix && strings.HasPrefix(vi.Tag, cfg.TagPrefix) {
+			vi.Version = DefaultTagPrefix + strings.TrimPrefix(vi.Tag, cfg.TagPrefix)
+		}
 		vi.Build = vs.GetBuild(repo)
 		branchText, branchName := vs.GetBranch(repo)
 		vi.Branch = branchName
+		vi.PullRequest = vs.GetPullRequest()
 
-		if vs.IsReleaseBranch(branchName) && sametree {
+		release := vs.MatchReleaseBranch(branchName)
+		// A release version needs a clean tree as well.
+		dirty := cfg.DirtyMarker != "" && vs.IsDirty(repo)
+		if vi.PullRequest == "" && release.Release && sametree && !dirty {
+			vs.explain(ExplainVersion, "", vi.Version, "release branch and tag has the current tree")
+			vi.Release = true
+			err = vs.checkMaintenanceLine(branchName, vi.Tag)
 			return
 		}
+		if release.Channel != "" {
+			// The channel replaces the branch name in the version.
+			vs.explain(ExplainSuffix, "channel", release.Channel, "replaces branch text %q", branchText)
+			branchText = release.Channel
+		}
 
-		suffix := branchText
+		td := TemplateData{VersionInfo: vi, BranchText: branchText}
+		td.Suffix = branchText
 		if vi.Build != "" {
-			if suffix != "" {
-				suffix += "."
+			if td.Suffix != "" {
+				td.Suffix += "."
 			}
-			suffix += vi.Build
+			td.Suffix += vi.Build
+		}
+		vs.explain(ExplainSuffix, "", td.Suffix, "branch text %q and build %q", branchText, vi.Build)
+		if dirty {
+			td.Dirty = cfg.DirtyMarker
+			vs.explain(ExplainSuffix, "dirty", td.Dirty, "uncommitted changes")
+		}
+
+		tmplText := cfg.Template
+		if vi.PullRequest != "" {
+			// Pull requests never get release versions, and must not collide with branch builds.
+			tmplText = cfg.PullRequestTemplate
+			vs.explain(ExplainVersion, "pullrequest", vi.PullRequest, "pull request build")
 		}
-		if suffix != "" {
-			vi.Version += "-" + suffix
+		if vi.Version, err = td.Execute(tmplText); err == nil {
+			vs.explain(ExplainVersion, "", vi.Version, "from template %q", tmplText)
+			err = vs.checkMaintenanceLine(branchName, vi.Tag)
 		}
 	}
 	return
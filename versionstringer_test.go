@@ -3,6 +3,8 @@
 package makeversion
 
 import (
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/matryer/is"
@@ -63,6 +65,15 @@ func Test_VersionStringer_IsReleaseBranch(t *testing.T) {
 	is.True(vs.IsReleaseBranch(branchName))
 	delete(env, "GITHUB_REF_PROTECTED")
 
+	env["BUILDKITE_PIPELINE_DEFAULT_BRANCH"] = branchName
+	is.True(vs.IsReleaseBranch(branchName))
+	is.True(!vs.IsReleaseBranch("main"))
+	delete(env, "BUILDKITE_PIPELINE_DEFAULT_BRANCH")
+
+	env["DRONE_REPO_BRANCH"] = branchName
+	is.True(vs.IsReleaseBranch(branchName))
+	delete(env, "DRONE_REPO_BRANCH")
+
 	is.True(!vs.IsReleaseBranch(branchName))
 }
 
@@ -122,6 +133,13 @@ func Test_VersionStringer_GetBranch(t *testing.T) {
 	is.Equal("github.branch", name)
 	is.Equal("github-branch", text)
 	delete(env, "GITHUB_REF_NAME")
+
+	git.branch = "feature/Größenänderung"
+	vs.Config = &Config{MaxBranchLength: 16}
+	text, _ = vs.GetBranch(".")
+	is.Equal(SanitizeBranchLength(git.branch, 16), text)
+	is.Equal("feature-", text[:8])
+	is.Equal(16, len(text))
 }
 
 func Test_VersionStringer_GetBranchFromTag_GitLab(t *testing.T) {
@@ -153,6 +171,69 @@ func Test_VersionStringer_GetBranchFromTag_GitHub(t *testing.T) {
 	text, name = vs.GetBranch(".")
 	is.Equal("onepointoh", name)
 	is.Equal("onepointoh", text)
+
+	// no branch contains the tag, as in a shallow clone
+	env["GITHUB_REF_NAME"] = "v2.0.0"
+	text, name = vs.GetBranch(".")
+	is.Equal("v2.0.0", name)
+	is.Equal("v2-0-0", text)
+	is.True(!vs.IsReleaseBranch(name))
+}
+
+func Test_VersionStringer_GetBranch_OtherCI(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env}
+
+	env["BUILDKITE_BRANCH"] = "buildkite/branch"
+	text, name := vs.GetBranch(".")
+	is.Equal("buildkite/branch", name)
+	is.Equal("buildkite-branch", text)
+
+	env["BUILDKITE_BRANCH"] = "v1.0.0"
+	env["BUILDKITE_TAG"] = "v1.0.0"
+	_, name = vs.GetBranch(".")
+	is.Equal("main", name)
+	delete(env, "BUILDKITE_BRANCH")
+	delete(env, "BUILDKITE_TAG")
+
+	env["CIRCLE_BRANCH"] = "circle"
+	_, name = vs.GetBranch(".")
+	is.Equal("circle", name)
+	delete(env, "CIRCLE_BRANCH")
+
+	env["CIRCLE_TAG"] = "v1"
+	_, name = vs.GetBranch(".")
+	is.Equal("onepointoh", name)
+	delete(env, "CIRCLE_TAG")
+
+	env["DRONE_BRANCH"] = "drone"
+	_, name = vs.GetBranch(".")
+	is.Equal("drone", name)
+
+	env["DRONE_TAG"] = "v1.0.0"
+	_, name = vs.GetBranch(".")
+	is.Equal("main", name)
+
+	env["DRONE_TAG"] = "v2.0.0"
+	_, name = vs.GetBranch(".")
+	is.Equal("v2.0.0", name)
+}
+
+func Test_VersionStringer_GetTag_OtherCI(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env}
+
+	for _, envvar := range []string{"BUILDKITE_TAG", "CIRCLE_TAG", "DRONE_TAG"} {
+		env[envvar] = "v3"
+		tag, sametree := vs.GetTag(".")
+		is.Equal("v3", tag)
+		is.Equal(true, sametree)
+		delete(env, envvar)
+	}
 }
 
 func Test_VersionStringer_GetBuild(t *testing.T) {
@@ -172,7 +253,14 @@ func Test_VersionStringer_GetBuild(t *testing.T) {
 	env["GITHUB_RUN_NUMBER"] = "789"
 	build = vs.GetBuild(".")
 	is.Equal("789", build)
-	delete(env, "CI_PIPELINE_IID")
+	delete(env, "GITHUB_RUN_NUMBER")
+
+	for _, envvar := range []string{"BUILDKITE_BUILD_NUMBER", "CIRCLE_BUILD_NUM", "DRONE_BUILD_NUMBER", "CI_PIPELINE_NUMBER"} {
+		env[envvar] = "321"
+		build = vs.GetBuild(".")
+		is.Equal("321", build)
+		delete(env, envvar)
+	}
 }
 
 func Test_VersionStringer_GetVersion(t *testing.T) {
@@ -189,10 +277,13 @@ func Test_VersionStringer_GetVersion(t *testing.T) {
 	is.NoErr(err)
 	is.Equal("v6.0.0-main.build", vi.Version)
 
+	is.True(!vi.Release)
+
 	git.treehash = "tree-6"
 	vi, err = vs.GetVersion(".")
 	is.NoErr(err)
 	is.Equal("v6.0.0", vi.Version)
+	is.True(vi.Release)
 
 	git.treehash = ""
 	env["CI_COMMIT_REF_NAME"] = "HEAD"
@@ -217,3 +308,336 @@ func Test_VersionStringer_GetVersion(t *testing.T) {
 	is.NoErr(err)
 	is.Equal("v6.0.0-main.789", vi.Version)
 }
+
+func Test_VersionStringer_GetPullRequest(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	vs := VersionStringer{Env: env}
+
+	is.Equal("", vs.GetPullRequest())
+
+	env["CI_MERGE_REQUEST_IID"] = "12"
+	is.Equal("12", vs.GetPullRequest())
+	delete(env, "CI_MERGE_REQUEST_IID")
+
+	env["GITHUB_REF_NAME"] = "34/merge"
+	is.Equal("", vs.GetPullRequest())
+	env["GITHUB_EVENT_NAME"] = "pull_request"
+	is.Equal("34", vs.GetPullRequest())
+	env["GITHUB_EVENT_PATH"] = "testdata/event-pull-request.json"
+	is.Equal("123", vs.GetPullRequest())
+	env["GITHUB_EVENT_NAME"] = "push"
+	is.Equal("", vs.GetPullRequest())
+}
+
+func Test_VersionStringer_GetVersion_PullRequest(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{
+		"GITHUB_EVENT_NAME": "pull_request",
+		"GITHUB_REF_NAME":   "123/merge",
+		"GITHUB_RUN_NUMBER": "45",
+	}
+	git := &MockGitter{treehash: "tree-6"}
+	vs := VersionStringer{Git: git, Env: env}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("123", vi.PullRequest)
+	is.Equal("123/merge", vi.Branch)
+	is.Equal("v6.0.0-pr.123.45", vi.Version)
+
+	delete(env, "GITHUB_EVENT_NAME")
+	delete(env, "GITHUB_REF_NAME")
+	env["CI_MERGE_REQUEST_IID"] = "7"
+	env["CI_COMMIT_REF_NAME"] = "feature"
+	vs.Config = &Config{PullRequestTemplate: "{{.Tag}}-mr{{.PullRequest}}"}
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("feature", vi.Branch)
+	is.Equal("v6.0.0-mr7", vi.Version)
+
+	vs.Config.PullRequestTemplate = "{{"
+	_, err = vs.GetVersion(".")
+	is.True(err != nil)
+}
+
+func Test_NewVersionStringerWithConfig(t *testing.T) {
+	is := is.New(t)
+	vs, err := NewVersionStringerWithConfig("git", ".", "testdata/config/.makeversion.json")
+	is.NoErr(err)
+	is.Equal("myapp/v", vs.Config.TagPrefix)
+
+	vs, err = NewVersionStringerWithConfig("git", ".", "")
+	is.NoErr(err)
+	is.Equal(vs.Config, nil)
+
+	vs, err = NewVersionStringerWithConfig("git", ".", "testdata/event-push.json")
+	is.True(err != nil)
+	is.Equal(vs, nil)
+}
+
+func Test_VersionStringer_Config(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env, Config: &Config{
+		ReleaseBranches: []ReleaseBranch{{Pattern: "release/*"}},
+		TagPattern:      "v[0-4]*",
+		DirtyMarker:     "dirty",
+		Fallback:        "v0.1.0",
+		CI: map[CI]*Config{
+			CIGitLab: {ReleaseBranches: []ReleaseBranch{{Pattern: "stable"}}},
+		},
+	}}
+
+	is.True(vs.IsReleaseBranch("release/1.2"))
+	is.True(vs.IsReleaseBranch("main"))
+	is.True(!vs.IsReleaseBranch("develop"))
+	env["GITLAB_CI"] = "true"
+	is.True(vs.IsReleaseBranch("stable"))
+	is.True(!vs.IsReleaseBranch("release/1.2"))
+	delete(env, "GITLAB_CI")
+
+	tag, sametree := vs.GetTag("/")
+	is.Equal("v0.1.0", tag)
+	is.Equal(false, sametree)
+
+	env["CI_COMMIT_TAG"] = "v6.0.0"
+	tag, _ = vs.GetTag(".")
+	is.Equal("v4.0.0", tag)
+	delete(env, "CI_COMMIT_TAG")
+
+	git.treehash = "tree-6"
+	tag, sametree = vs.GetTag(".")
+	is.Equal("v4.0.0", tag)
+	is.Equal(false, sametree)
+
+	git.treehash = ""
+	is.True(!vs.IsDirty("."))
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0-main.build", vi.Version)
+
+	git.treehash = "tree-4"
+	is.True(vs.IsDirty("."))
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0-main.build+dirty", vi.Version)
+}
+
+func Test_VersionStringer_GetVersion_DirtyRelease(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{treehash: "tree-6"}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v6.0.0", vi.Version)
+	is.True(vi.Release)
+
+	// the tag has the current tree, but HEAD doesn't
+	vs.Config = &Config{DirtyMarker: "dirty"}
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v6.0.0-main.build+dirty", vi.Version)
+	is.True(!vi.Release)
+}
+
+func Test_VersionStringer_GetTag_Unfiltered(t *testing.T) {
+	is := is.New(t)
+	dg, err := NewDefaultGitter("git")
+	is.NoErr(err)
+	repo := makeTestRepo(t, 2, map[int]string{1: "v1.0.0", 2: "release-7"})
+	env := MockEnvironment{"CI_COMMIT_TAG": "1.2.3"}
+	vs := VersionStringer{Git: dg, Env: env}
+
+	// without a configured tag pattern, any tag given by CI or on the current tree is used
+	tag, sametree := vs.GetTag(repo)
+	is.Equal("1.2.3", tag)
+	is.True(sametree)
+	delete(env, "CI_COMMIT_TAG")
+	tag, sametree = vs.GetTag(repo)
+	is.Equal("release-7", tag)
+	is.True(sametree)
+
+	vs.Config = &Config{TagPattern: "v[0-9]*"}
+	tag, sametree = vs.GetTag(repo)
+	is.Equal("v1.0.0", tag)
+	is.True(!sametree)
+	env["CI_COMMIT_TAG"] = "1.2.3"
+	tag, _ = vs.GetTag(repo)
+	is.Equal("v1.0.0", tag)
+}
+
+func Test_VersionStringer_TagPrefix(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{"CI_COMMIT_TAG": "myapp/v1.2.3", "CI_COMMIT_REF_NAME": "feature"}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env, Config: &Config{
+		TagPrefix: "myapp/v",
+		Template:  "{{.Version}}-{{.BranchText}}",
+	}}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("myapp/v1.2.3", vi.Tag)
+	is.Equal("v1.2.3-feature", vi.Version)
+
+	vs.Config.Template = "{{.Version"
+	_, err = vs.GetVersion(".")
+	is.True(err != nil)
+}
+
+func Test_VersionStringer_MatchReleaseBranch(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{}
+	vs := VersionStringer{Env: env, Config: &Config{
+		ReleaseBranches: []ReleaseBranch{
+			{Pattern: "develop", Channel: "beta"},
+			{Pattern: "release/*", Channel: "rc"},
+			{Regex: `^hotfix/\d+$`},
+		},
+	}}
+
+	m := vs.MatchReleaseBranch("develop")
+	is.Equal(ReleaseMatch{Release: true, Pattern: "develop", Channel: "beta", Reason: `the branch matches release branch pattern "develop"`}, m)
+
+	m = vs.MatchReleaseBranch("release/1.4")
+	is.True(m.Release)
+	is.Equal("release/*", m.Pattern)
+	is.Equal("rc", m.Channel)
+
+	m = vs.MatchReleaseBranch("hotfix/12")
+	is.True(m.Release)
+	is.Equal(`/^hotfix/\d+$/`, m.Pattern)
+	is.Equal("", m.Channel)
+
+	// the default names are still release branches
+	m = vs.MatchReleaseBranch("main")
+	is.Equal(ReleaseMatch{Release: true, Reason: `the branch is named "main"`}, m)
+
+	m = vs.MatchReleaseBranch("feature")
+	is.True(!m.Release)
+	is.Equal("the branch is not a release branch", m.Reason)
+
+	env["CI_DEFAULT_BRANCH"] = "main"
+	is.True(vs.IsReleaseBranch("main"))
+	is.True(vs.IsReleaseBranch("release/1.4"))
+	m = vs.MatchReleaseBranch("feature")
+	is.True(!m.Release)
+	is.Equal(`the branch is not the default branch "main"`, m.Reason)
+	delete(env, "CI_DEFAULT_BRANCH")
+
+	env["CI_COMMIT_REF_PROTECTED"] = "true"
+	m = vs.MatchReleaseBranch("develop")
+	is.True(m.Release)
+	is.Equal("beta", m.Channel)
+	is.Equal("the branch is protected", m.Reason)
+	delete(env, "CI_COMMIT_REF_PROTECTED")
+
+	m = vs.MatchReleaseBranch("")
+	is.True(m.Release)
+	is.Equal("HEAD is detached", m.Reason)
+}
+
+func Test_VersionStringer_GetVersion_Channel(t *testing.T) {
+	is := is.New(t)
+	env := MockEnvironment{"CI_COMMIT_REF_NAME": "release/1.4", "CI_PIPELINE_IID": "45"}
+	git := &MockGitter{}
+	vs := VersionStringer{Git: git, Env: env, Config: &Config{
+		ReleaseBranches: []ReleaseBranch{{Pattern: "release/*", Channel: "rc"}},
+	}}
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("release/1.4", vi.Branch)
+	is.Equal("v6.0.0-rc.45", vi.Version)
+
+	is.True(!vi.Release)
+
+	git.treehash = "tree-6"
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v6.0.0", vi.Version)
+	is.True(vi.Release)
+}
+
+func Test_VersionStringer_GetMaintenanceLine(t *testing.T) {
+	is := is.New(t)
+	vs := VersionStringer{Env: MockEnvironment{}}
+
+	_, _, ok := vs.GetMaintenanceLine("release/1.4")
+	is.True(!ok)
+
+	vs.Config = &Config{MaintenanceBranch: DefaultMaintenanceBranch}
+	for branchName, expect := range map[string][2]int{
+		"release/1.4":       {1, 4},
+		"hotfix/v2.10":      {2, 10},
+		"maintenance/0.9.x": {0, 9},
+	} {
+		major, minor, ok := vs.GetMaintenanceLine(branchName)
+		is.True(ok)
+		is.Equal(expect, [2]int{major, minor})
+	}
+	for _, branchName := range []string{"main", "release/1", "release/1.4.2", "feature/release/1.4"} {
+		_, _, ok = vs.GetMaintenanceLine(branchName)
+		is.True(!ok)
+	}
+}
+
+func Test_VersionStringer_GetVersion_Maintenance(t *testing.T) {
+	is := is.New(t)
+	git := &MockGitter{branch: "release/4.0", treehash: "tree-6"}
+	vs := VersionStringer{Git: git, Env: MockEnvironment{}, Config: &Config{
+		MaintenanceBranch: DefaultMaintenanceBranch,
+	}}
+
+	// v6.0.0 matches the tree, but isn't in the 4.0 line
+	tag, sametree := vs.GetTag(".")
+	is.Equal("v4.0.0", tag)
+	is.Equal(false, sametree)
+
+	vi, err := vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0-release-4-0.build", vi.Version)
+
+	git.treehash = "tree-4"
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0-release-4-0.build", vi.Version)
+
+	vs.Config.ReleaseBranches = []ReleaseBranch{{Pattern: "release/*"}}
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0", vi.Version)
+
+	// no 5.0 tag to be found
+	git.branch = "release/5.0"
+	vi, err = vs.GetVersion(".")
+	is.True(err != nil)
+	is.Equal("v0.0.0-release-5-0.build", vi.Version)
+	is.True(strings.Contains(err.Error(), `"release/5.0" requires a 5.0.x version`))
+
+	// the tag is checked, so templates needn't make semantic versions
+	git.branch = "release/4.0"
+	vs.Config.ReleaseBranches = nil
+	vs.Config.Template = "{{.Version}}_{{.Build}}"
+	vi, err = vs.GetVersion(".")
+	is.NoErr(err)
+	is.Equal("v4.0.0_build", vi.Version)
+
+	// a CI tag outside the line is an error too
+	vs.Env = MockEnvironment{"CI_COMMIT_TAG": "v6.0.0", "CI_COMMIT_REF_NAME": "release/4.0"}
+	_, err = vs.GetVersion(".")
+	is.True(err != nil)
+}
+
+func Test_escapeGlob(t *testing.T) {
+	is := is.New(t)
+	pattern := escapeGlob(`r[1]*?\-`) + "4.0.*"
+	ok, err := path.Match(pattern, `r[1]*?\-4.0.1`)
+	is.NoErr(err)
+	is.True(ok)
+	ok, _ = path.Match(pattern, `r1xy\-4.0.1`)
+	is.True(!ok)
+}
@@ -0,0 +1,148 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// MaxWindowsVersionPart is the largest number allowed in each part of a Windows version.
+const MaxWindowsVersionPart = 65535
+
+// WindowsVersion is a four-part Windows file or product version, as used in
+// VS_VERSIONINFO resources. The field names match the JSON used by goversioninfo.
+type WindowsVersion struct {
+	Major int
+	Minor int
+	Patch int
+	Build int
+}
+
+// String returns the version as "Major.Minor.Patch.Build", e.g. "1.2.3.45".
+func (wv WindowsVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", wv.Major, wv.Minor, wv.Patch, wv.Build)
+}
+
+// WindowsVersion returns the version as a four-part Windows version, with the
+// build counter as the fourth part. A build counter larger than MaxWindowsVersionPart
+// is clamped to it, and clamped is true. An empty build counter is zero.
+//
+// Returns an error if the version isn't a semantic version, if the major, minor
+// or patch number is larger than MaxWindowsVersionPart, or if the build counter
+// isn't a number.
+func (vi *VersionInfo) WindowsVersion() (wv WindowsVersion, clamped bool, err error) {
+	var sv Semver
+	if sv, err = ParseSemver(vi.Version); err == nil {
+		wv = WindowsVersion{Major: sv.Major, Minor: sv.Minor, Patch: sv.Patch}
+		for _, part := range []int{sv.Major, sv.Minor, sv.Patch} {
+			if part > MaxWindowsVersionPart {
+				return wv, false, fmt.Errorf("%q: %d is larger than %d, the largest allowed in Windows versions", vi.Version, part, MaxWindowsVersionPart)
+			}
+		}
+		if vi.Build != "" {
+			var build uint64
+			if build, err = strconv.ParseUint(vi.Build, 10, 64); err != nil {
+				if numErr, ok := err.(*strconv.NumError); !ok || numErr.Err != strconv.ErrRange {
+					return wv, false, fmt.Errorf("build %q is not a number", vi.Build)
+				}
+				err = nil
+				build = MaxWindowsVersionPart + 1
+			}
+			if clamped = build > MaxWindowsVersionPart; clamped {
+				build = MaxWindowsVersionPart
+			}
+			wv.Build = int(build)
+		}
+	}
+	return
+}
+
+// GoVersionInfo is the versioninfo.json file read by goversioninfo
+// (https://github.com/josephspurrier/goversioninfo) to make Windows resources.
+type GoVersionInfo struct {
+	FixedFileInfo  GoVersionInfoFixed   `json:"FixedFileInfo"`
+	StringFileInfo GoVersionInfoStrings `json:"StringFileInfo"`
+	VarFileInfo    GoVersionInfoVars    `json:"VarFileInfo"`
+}
+
+// GoVersionInfoFixed is the VS_FIXEDFILEINFO part of a GoVersionInfo.
+type GoVersionInfoFixed struct {
+	FileVersion    WindowsVersion `json:"FileVersion"`
+	ProductVersion WindowsVersion `json:"ProductVersion"`
+	FileFlagsMask  string         `json:"FileFlagsMask"`
+	FileFlags      string         `json:"FileFlags "` // sic, goversioninfo expects the trailing space
+	FileOS         string         `json:"FileOS"`
+	FileType       string         `json:"FileType"`
+	FileSubType    string         `json:"FileSubType"`
+}
+
+// GoVersionInfoStrings is the StringFileInfo part of a GoVersionInfo.
+type GoVersionInfoStrings struct {
+	Comments         string `json:"Comments,omitempty"`
+	CompanyName      string `json:"CompanyName,omitempty"`
+	FileDescription  string `json:"FileDescription,omitempty"`
+	FileVersion      string `json:"FileVersion"`
+	InternalName     string `json:"InternalName,omitempty"`
+	LegalCopyright   string `json:"LegalCopyright,omitempty"`
+	LegalTrademarks  string `json:"LegalTrademarks,omitempty"`
+	OriginalFilename string `json:"OriginalFilename,omitempty"`
+	PrivateBuild     string `json:"PrivateBuild,omitempty"`
+	ProductName      string `json:"ProductName,omitempty"`
+	ProductVersion   string `json:"ProductVersion"`
+	SpecialBuild     string `json:"SpecialBuild,omitempty"`
+}
+
+// GoVersionInfoVars is the VarFileInfo part of a GoVersionInfo.
+type GoVersionInfoVars struct {
+	Translation struct {
+		LangID    string `json:"LangID"`
+		CharsetID string `json:"CharsetID"`
+	} `json:"Translation"`
+}
+
+// Windows VS_FIXEDFILEINFO file flags, in hex as goversioninfo wants them.
+const (
+	vsFFPrerelease = "02"
+	vsFFNone       = "00"
+)
+
+// GoVersionInfo returns the resource data for the version, for an executable
+// named productName (which may be empty). The file and product version are the
+// WindowsVersion, the product version string is the Version, and prereleases
+// have the VS_FF_PRERELEASE flag. See WindowsVersion for the errors returned.
+func (vi *VersionInfo) GoVersionInfo(productName string) (gvi GoVersionInfo, clamped bool, err error) {
+	var wv WindowsVersion
+	if wv, clamped, err = vi.WindowsVersion(); err == nil {
+		sv, _ := ParseSemver(vi.Version)
+		flags := vsFFNone
+		if sv.Pre != "" {
+			flags = vsFFPrerelease
+		}
+		gvi.FixedFileInfo = GoVersionInfoFixed{
+			FileVersion:    wv,
+			ProductVersion: wv,
+			FileFlagsMask:  "3f",
+			FileFlags:      flags,
+			FileOS:         "040004", // VOS_NT_WINDOWS32
+			FileType:       "01",     // VFT_APP
+			FileSubType:    "00",
+		}
+		gvi.StringFileInfo = GoVersionInfoStrings{
+			FileVersion:    wv.String(),
+			ProductName:    productName,
+			ProductVersion: vi.Version,
+		}
+		if vi.Branch != "" || vi.Build != "" {
+			gvi.StringFileInfo.Comments = fmt.Sprintf("branch %s, build %s", vi.Branch, vi.Build)
+		}
+		gvi.VarFileInfo.Translation.LangID = "0409"    // U.S. English
+		gvi.VarFileInfo.Translation.CharsetID = "04B0" // Unicode
+	}
+	return
+}
+
+// JSON returns the resource data as indented JSON.
+func (gvi *GoVersionInfo) JSON() (string, error) {
+	b, err := json.MarshalIndent(gvi, "", "  ")
+	return string(b), err
+}
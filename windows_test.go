@@ -0,0 +1,83 @@
+package makeversion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func Test_VersionInfo_WindowsVersion(t *testing.T) {
+	is := is.New(t)
+	vi := VersionInfo{Version: "v1.2.3-feature.45", Build: "45"}
+	wv, clamped, err := vi.WindowsVersion()
+	is.NoErr(err)
+	is.True(!clamped)
+	is.Equal(WindowsVersion{Major: 1, Minor: 2, Patch: 3, Build: 45}, wv)
+	is.Equal("1.2.3.45", wv.String())
+
+	vi.Build = ""
+	wv, _, err = vi.WindowsVersion()
+	is.NoErr(err)
+	is.Equal("1.2.3.0", wv.String())
+
+	for _, build := range []string{"65536", "123456789", "99999999999999999999999"} {
+		vi.Build = build
+		wv, clamped, err = vi.WindowsVersion()
+		is.NoErr(err)
+		is.True(clamped)
+		is.Equal(MaxWindowsVersionPart, wv.Build)
+	}
+	vi.Build = "65535"
+	_, clamped, _ = vi.WindowsVersion()
+	is.True(!clamped)
+
+	for _, vi := range []VersionInfo{
+		{Version: "v1.2.3", Build: "abc"},
+		{Version: "v1.2.3", Build: "-1"},
+		{Version: "v65536.0.0", Build: "1"},
+		{Version: "v1.0.70000", Build: "1"},
+		{Version: "v1.2", Build: "1"},
+	} {
+		_, _, err = vi.WindowsVersion()
+		is.True(err != nil)
+	}
+}
+
+func Test_VersionInfo_GoVersionInfo(t *testing.T) {
+	is := is.New(t)
+	vi := VersionInfo{Version: "v1.2.3-feature.45", Branch: "feature", Build: "45"}
+	gvi, _, err := vi.GoVersionInfo("myapp")
+	is.NoErr(err)
+	is.Equal(WindowsVersion{Major: 1, Minor: 2, Patch: 3, Build: 45}, gvi.FixedFileInfo.FileVersion)
+	is.Equal(gvi.FixedFileInfo.FileVersion, gvi.FixedFileInfo.ProductVersion)
+	is.Equal(vsFFPrerelease, gvi.FixedFileInfo.FileFlags)
+	is.Equal("1.2.3.45", gvi.StringFileInfo.FileVersion)
+	is.Equal("v1.2.3-feature.45", gvi.StringFileInfo.ProductVersion)
+	is.Equal("myapp", gvi.StringFileInfo.ProductName)
+	is.Equal("branch feature, build 45", gvi.StringFileInfo.Comments)
+
+	s, err := gvi.JSON()
+	is.NoErr(err)
+	var m map[string]map[string]interface{}
+	is.NoErr(json.Unmarshal([]byte(s), &m))
+	is.Equal("02", m["FixedFileInfo"]["FileFlags "])
+	is.Equal("0409", m["VarFileInfo"]["Translation"].(map[string]interface{})["LangID"])
+
+	vi.Version = "v1.2.3"
+	gvi, _, err = vi.GoVersionInfo("")
+	is.NoErr(err)
+	is.Equal(vsFFNone, gvi.FixedFileInfo.FileFlags)
+
+	s, err = vi.Format(FormatGoVersion)
+	is.NoErr(err)
+	is.True(strings.Contains(s, `"ProductVersion": "v1.2.3"`))
+	s, err = vi.Format(FormatWindows)
+	is.NoErr(err)
+	is.Equal("1.2.3.45", s)
+
+	vi.Version = "v1.2.3000000"
+	_, err = vi.Format(FormatGoVersion)
+	is.True(err != nil)
+}